@@ -0,0 +1,35 @@
+package dassim
+
+import "math/bits"
+
+// bitset is a fixed-size set of bits packed into 64-bit words
+type bitset []uint64
+
+// newBitset creates a bitset able to hold n bits, all unset
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+// get reports whether bit i is set
+func (b bitset) get(i int) bool {
+	return b[i/64]&(1<<(i%64)) != 0
+}
+
+// set sets bit i
+func (b bitset) set(i int) {
+	b[i/64] |= 1 << (i % 64)
+}
+
+// reset unsets all bits
+func (b bitset) reset() {
+	clear(b)
+}
+
+// count returns the number of set bits
+func (b bitset) count() int {
+	n := 0
+	for _, w := range b {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
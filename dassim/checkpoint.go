@@ -0,0 +1,161 @@
+package dassim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// checkpoint is the state of a simulation written to CheckpointPath
+type checkpoint struct {
+	Config *SimulationConfig `json:"config"`
+
+	// Seed is the resolved base seed, so a resumed run samples exactly like
+	// the interrupted one even when Config.Seed is 0
+	Seed int64 `json:"seed"`
+
+	// Cluster is Config.Distribution when it is a ClusteredDistribution,
+	// which Config does not serialize
+	Cluster *ClusteredDistribution `json:"cluster,omitempty"`
+
+	// Repeat, Size and Lights are the position of the last completed probe
+	Repeat int `json:"repeat"`
+	Size   int `json:"size"`
+	Lights int `json:"lights"`
+
+	Results []SimulationResult `json:"results"`
+}
+
+// probeKey identifies a single probe of a simulation
+type probeKey struct {
+	model                         SamplingModel
+	repeat, size, lights, samples int
+}
+
+// checkpointer accumulates the results of a simulation and periodically
+// writes them to config.CheckpointPath
+type checkpointer struct {
+	mu      sync.Mutex
+	state   checkpoint
+	pending int
+}
+
+// newCheckpointer starts a checkpoint of a simulation of config sampled from
+// seed, holding the results completed before it was resumed
+func newCheckpointer(config *SimulationConfig, seed int64, completed []SimulationResult) *checkpointer {
+	state := checkpoint{Config: config, Seed: seed, Results: slices.Clone(completed)}
+	if d, ok := config.Distribution.(ClusteredDistribution); ok {
+		state.Cluster = &d
+	}
+	if n := len(completed); n > 0 {
+		last := completed[n-1]
+		state.Repeat, state.Size, state.Lights = last.Repeat, last.Size, last.Lights
+	}
+	return &checkpointer{state: state}
+}
+
+// record adds a completed probe and writes the checkpoint once
+// CheckpointEvery probes have completed since the last write
+func (c *checkpointer) record(result SimulationResult) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state.Repeat, c.state.Size, c.state.Lights = result.Repeat, result.Size, result.Lights
+	c.state.Results = append(c.state.Results, result)
+	c.pending++
+	if c.pending < max(c.state.Config.CheckpointEvery, 1) {
+		return nil
+	}
+	return c.writeLocked()
+}
+
+// write writes the checkpoint with all probes recorded so far
+func (c *checkpointer) write() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.writeLocked()
+}
+
+func (c *checkpointer) writeLocked() error {
+	data, err := json.Marshal(c.state)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(c.state.Config.CheckpointPath, data); err != nil {
+		return fmt.Errorf("writing checkpoint: %w", err)
+	}
+	c.pending = 0
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with data by writing a temporary
+// file in the same directory and renaming it, so a crash never leaves a
+// truncated file behind
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// checkpointable reports whether a checkpoint can restore d
+func checkpointable(d Distribution) bool {
+	switch d.(type) {
+	case nil, UniformDistribution, ClusteredDistribution:
+		return true
+	default:
+		return false
+	}
+}
+
+// ResumeSimulation continues the simulation checkpointed at checkpointPath
+// and returns all its results, including those completed before the
+// checkpoint. Completed probes are not run again, and since every probe is
+// sampled from the checkpointed seed the remaining ones produce the results
+// the interrupted run would have. The run keeps checkpointing to the same
+// file. A ClusteredDistribution is restored from the checkpoint, while the
+// callbacks cannot be stored in it and are left unset.
+func ResumeSimulation(checkpointPath string) ([]SimulationResult, error) {
+	data, err := os.ReadFile(checkpointPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var state checkpoint
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parsing checkpoint %s: %w", checkpointPath, err)
+	}
+	if state.Config == nil {
+		return nil, fmt.Errorf("parsing checkpoint %s: missing config", checkpointPath)
+	}
+
+	config := state.Config
+	config.Seed = state.Seed
+	config.CheckpointPath = checkpointPath
+	if state.Cluster != nil {
+		config.Distribution = *state.Cluster
+	}
+
+	config.logf("Resuming from checkpoint %s with %d completed probes, last at size %d with %d lights\n",
+		checkpointPath, len(state.Results), state.Size, state.Lights)
+
+	return simulate(context.Background(), config, nil, state.Results)
+}
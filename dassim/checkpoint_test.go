@@ -0,0 +1,93 @@
+package dassim
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResumeMatchesUninterruptedRun(t *testing.T) {
+	for _, dist := range []Distribution{nil, ClusteredDistribution{Origin: 0, Extent: 0.75, Weight: 0.5}} {
+		t.Run(fmt.Sprintf("%T", dist), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "checkpoint.json")
+			config := NewDefaultConfig()
+			config.MaxSize = 32
+			config.Iterations = 50
+			config.Seed = 5
+			config.Verbose = false
+			config.CheckpointPath = path
+			config.Distribution = dist
+
+			want, err := RunSimulation(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// cut the checkpoint short as if the run had been interrupted
+			var state checkpoint
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(data, &state); err != nil {
+				t.Fatal(err)
+			}
+			state.Results = state.Results[:len(state.Results)/2]
+			if data, err = json.Marshal(state); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ResumeSimulation(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, err = os.ReadFile(path); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(data, &state); err != nil {
+				t.Fatal(err)
+			}
+			if len(state.Results) != len(want) {
+				t.Fatalf("checkpoint holds %d results after resuming, want %d", len(state.Results), len(want))
+			}
+
+			for _, results := range [][]SimulationResult{want, got} {
+				for i := range results {
+					results[i].Duration = 0
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("resumed results differ from the uninterrupted run:\n%+v\n%+v", got, want)
+			}
+		})
+	}
+}
+
+// shiftedDistribution is a Distribution a checkpoint cannot restore
+type shiftedDistribution struct{}
+
+func (shiftedDistribution) Sample(rng *rand.Rand, size int) (row, col int) {
+	return rng.Intn(size), size + rng.Intn(size)
+}
+
+func TestCheckpointRejectsUnserializableFields(t *testing.T) {
+	config := NewDefaultConfig()
+	config.CheckpointPath = filepath.Join(t.TempDir(), "checkpoint.json")
+	config.Distribution = shiftedDistribution{}
+	if err := config.Validate(); err == nil {
+		t.Fatal("Validate accepted checkpointing a custom Distribution")
+	}
+
+	config.Distribution = nil
+	config.SamplesPerNode = func(rng *rand.Rand) int { return 1 + rng.Intn(8) }
+	if err := config.Validate(); err == nil {
+		t.Fatal("Validate accepted checkpointing SamplesPerNode")
+	}
+}
@@ -0,0 +1,458 @@
+package dassim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"slices"
+	"time"
+)
+
+// SimulationConfig holds the configuration for running simulations
+type SimulationConfig struct {
+	// SamplesPerIteration is the number of unique samples to generate in each iteration
+	// This represents how many points we try to recover in each step
+	SamplesPerIteration int `json:"samples_per_iteration"`
+
+	// SamplesPerNode, if set, draws the number of unique samples of every
+	// light node instead of using SamplesPerIteration, which models a
+	// population of light nodes with different sampling budgets
+	// It is called from the trial workers, so it must only use rng
+	SamplesPerNode func(rng *rand.Rand) int `json:"-"`
+
+	// Iterations is the number of times to run each simulation scenario
+	// Higher values provide more accurate probability estimates but take longer to run
+	Iterations int `json:"iterations"`
+
+	// AdaptiveIterations runs the trials of each lights count in batches of
+	// Iterations until the half-width of the 95% Wilson interval drops below
+	// Precision or MaxIterations trials have run
+	AdaptiveIterations bool    `json:"adaptive_iterations"`
+	Precision          float64 `json:"precision"`
+	MaxIterations      int     `json:"max_iterations"`
+
+	// InitialLights is the starting number of light sources for the simulation
+	// This value may be overridden by LightsAt16 calculation
+	InitialLights int `json:"initial_lights"`
+
+	// LightsAt16 is used to calculate InitialLights for different grid sizes
+	// If non-zero, InitialLights is scaled proportionally to the grid size
+	// Formula: InitialLights = LightsAt16 * (currentSize^2) / (16^2)
+	// With OneD it scales linearly: LightsAt16 * currentSize / 16
+	LightsAt16 int `json:"lights_at_16"`
+
+	// SizeIterFactor determines how much to increment the number of lights
+	// in each iteration. The increment is calculated as: size / SizeIterFactor,
+	// but is at least 1 so sizes below SizeIterFactor still make progress
+	SizeIterFactor int `json:"size_iter_factor"`
+
+	// InitialSize is the starting size for the data square
+	// The actual grid will be 2x this size in both dimensions
+	InitialSize int `json:"initial_size"`
+
+	// MaxSize is the largest size to test
+	// The simulation will double the size until reaching this value
+	MaxSize int `json:"max_size"`
+
+	// Sizes, if not empty, lists the sizes to simulate in order, each a
+	// distinct positive power of two, instead of doubling from InitialSize to MaxSize
+	Sizes []int `json:"sizes"`
+
+	// MaxLights caps the number of lights probed per size, so an unreachable
+	// TargetProbability ends the search with an unreached threshold instead
+	// of running forever. A value of 0 uses 4 * size^2.
+	MaxLights int `json:"max_lights"`
+
+	// TargetProbability is the success rate we want to achieve
+	// Once this probability is reached, we move to the next size
+	// Value should be between 0 and 1 (e.g., 0.99 for 99%)
+	TargetProbability float64 `json:"target_probability"`
+
+	// TargetProbabilities, if not empty, replaces TargetProbability with
+	// several targets in ascending order. The threshold of every target is
+	// recorded from the same probes and the search only moves on to the next
+	// size once the highest target is met.
+	TargetProbabilities []float64 `json:"target_probabilities"`
+
+	// RecoveryThreshold is the number of samples a row or column needs to be recovered
+	// A value of 0 uses the size k of the original data, the Reed-Solomon threshold
+	RecoveryThreshold int `json:"recovery_threshold"`
+
+	// AlwaysPropagate runs the recovery loop of every trial even when there
+	// are too few samples for full recovery to be possible
+	AlwaysPropagate bool `json:"always_propagate"`
+
+	// WithheldFraction is the fraction of cells of the extended square that a
+	// malicious block producer withholds in every trial, in [0,1)
+	// Withheld cells cannot be sampled but can still be recovered
+	WithheldFraction float64 `json:"withheld_fraction"`
+
+	// WithheldColumns is the number of whole columns of the extended square,
+	// picked at random in every trial, that the block producer withholds in
+	// addition to WithheldFraction, an adversary targeting column recovery
+	WithheldColumns int `json:"withheld_columns"`
+
+	// LossProbability is the chance that a requested sample never arrives,
+	// drawn independently for every sample, in [0,1)
+	LossProbability float64 `json:"loss_probability"`
+
+	// Distribution picks the cells light nodes sample
+	// A nil Distribution samples uniformly
+	Distribution Distribution `json:"-"`
+
+	// SampleRegion restricts sampling to the original data quadrant
+	// (OriginalBlock) instead of the whole extended square (FullSquare, the default)
+	SampleRegion SampleRegion `json:"sample_region"`
+
+	// Dimension selects whether the 2D scheme (TwoD, the default) or a 1D
+	// baseline vector of 2k cells (OneD) is recovered, so the samples both
+	// need can be compared with the same sweep
+	Dimension Dimension `json:"dimension"`
+
+	// SamplingModel selects whether light nodes sample independently (PerNode,
+	// the default) or from one shared pool without collisions (SharedUnique)
+	SamplingModel SamplingModel `json:"sampling_model"`
+
+	// CompareModels runs the whole sweep once for each listed sampling model,
+	// all from the same seed, replacing SamplingModel. Every result carries
+	// the model it was simulated with.
+	CompareModels []SamplingModel `json:"compare_models"`
+
+	// WithReplacement draws the samples of every light node, or the shared
+	// pool with SharedUnique, with replacement, modelling naive clients that
+	// may request the same cell twice. Duplicates collapse in the square and
+	// show up as a lower CoverageEfficiency.
+	WithReplacement bool `json:"with_replacement"`
+
+	// Repeats is the number of times the whole sweep is run, each with a
+	// distinct seed derived from Seed, so Aggregate can report the
+	// run-to-run spread of the thresholds. Values below 2 run a single sweep.
+	Repeats int `json:"repeats"`
+
+	// ConservativeThreshold compares the lower bound of the 95% Wilson score
+	// interval against TargetProbability instead of the point estimate
+	ConservativeThreshold bool `json:"conservative_threshold"`
+
+	// SearchStrategy selects how the threshold lights count is searched for
+	// LinearSearch (the default) steps by size / SizeIterFactor, BinarySearch
+	// doubles and then bisects to the smallest passing count
+	SearchStrategy SearchStrategy `json:"search_strategy"`
+
+	// SweepVariable selects whether the lights count (SweepLights, the
+	// default) or the samples per node at a fixed lights count
+	// (SweepSamplesPerNode) is searched for each size
+	SweepVariable SweepVariable `json:"sweep_variable"`
+
+	// Parallel spreads the iterations of each lights count across all CPU cores
+	// Results are identical to a sequential run with the same Seed
+	Parallel bool `json:"parallel"`
+
+	// ParallelSizes is the number of sizes simulated concurrently, each with
+	// its own squares and random sources. Results are still returned in size
+	// order and are identical to a sequential run, but log lines, callbacks
+	// and streamed results of different sizes interleave, so OnSizeStart and
+	// OnProbe must be safe for concurrent use. Values below 2 simulate one
+	// size at a time.
+	ParallelSizes int `json:"parallel_sizes"`
+
+	// Seed initializes the random source used for sampling
+	// A value of 0 picks a time-based seed, which is logged so the run can be replayed
+	Seed int64 `json:"seed"`
+
+	// Verbose enables logging of progress and per-probe results
+	// Results are returned from RunSimulation regardless of this setting
+	Verbose bool `json:"verbose"`
+
+	// CheckpointPath, if set, is the file the accumulated results and the
+	// position of the last probe are written to after every CheckpointEvery
+	// probes and when the simulation stops, so ResumeSimulation can continue
+	// it. Values of CheckpointEvery below 1 write after every probe.
+	CheckpointPath  string `json:"checkpoint_path"`
+	CheckpointEvery int    `json:"checkpoint_every"`
+
+	// OnSizeStart, if set, is called whenever RunSimulation starts a new size
+	OnSizeStart func(size int) `json:"-"`
+
+	// OnProbe, if set, is called after all iterations of a lights count completed
+	OnProbe func(size, lights, successCount, iterations int) `json:"-"`
+}
+
+// NewDefaultConfig creates a SimulationConfig with default values
+func NewDefaultConfig() *SimulationConfig {
+	return &SimulationConfig{
+		SamplesPerIteration: 16,
+		Iterations:          1000,
+		Precision:           0.005,
+		MaxIterations:       20000,
+		LightsAt16:          10,
+		InitialLights:       7500,
+		SizeIterFactor:      16,
+		InitialSize:         16,
+		MaxSize:             256,
+		TargetProbability:   0.99,
+		Parallel:            true,
+		Verbose:             true,
+	}
+}
+
+// LoadConfig reads a SimulationConfig from the JSON file at path, using the
+// snake_case field names of the JSON output. Fields missing from the file
+// keep their NewDefaultConfig values.
+func LoadConfig(path string) (*SimulationConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := NewDefaultConfig()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(config); err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Validate reports the first field of the config that the simulation cannot
+// run with, such as a zero SizeIterFactor or a size that is not a power of two
+func (c *SimulationConfig) Validate() error {
+	// the size checks come first, since later checks depend on minSize
+	for i, size := range c.Sizes {
+		if !isPowerOfTwo(size) {
+			return fmt.Errorf("Sizes must be positive powers of two, got %d", size)
+		}
+		if slices.Contains(c.Sizes[:i], size) {
+			return fmt.Errorf("Sizes must not repeat a size, got %d twice", size)
+		}
+	}
+	switch {
+	case len(c.Sizes) == 0 && !isPowerOfTwo(c.InitialSize):
+		return fmt.Errorf("InitialSize must be a positive power of two, got %d", c.InitialSize)
+	case len(c.Sizes) == 0 && !isPowerOfTwo(c.MaxSize):
+		return fmt.Errorf("MaxSize must be a positive power of two, got %d", c.MaxSize)
+	case len(c.Sizes) == 0 && c.InitialSize > c.MaxSize:
+		return fmt.Errorf("InitialSize %d must not exceed MaxSize %d", c.InitialSize, c.MaxSize)
+	case c.SamplesPerIteration <= 0:
+		return fmt.Errorf("SamplesPerIteration must be positive, got %d", c.SamplesPerIteration)
+	case c.Iterations <= 0:
+		return fmt.Errorf("Iterations must be positive, got %d", c.Iterations)
+	case c.MaxIterations < 0:
+		return fmt.Errorf("MaxIterations must not be negative, got %d", c.MaxIterations)
+	case c.InitialLights < 0:
+		return fmt.Errorf("InitialLights must not be negative, got %d", c.InitialLights)
+	case c.LightsAt16 < 0:
+		return fmt.Errorf("LightsAt16 must not be negative, got %d", c.LightsAt16)
+	case c.Repeats < 0:
+		return fmt.Errorf("Repeats must not be negative, got %d", c.Repeats)
+	case c.ParallelSizes < 0:
+		return fmt.Errorf("ParallelSizes must not be negative, got %d", c.ParallelSizes)
+	case c.CheckpointEvery < 0:
+		return fmt.Errorf("CheckpointEvery must not be negative, got %d", c.CheckpointEvery)
+	case c.AdaptiveIterations && c.Precision <= 0:
+		return fmt.Errorf("Precision must be positive with AdaptiveIterations, got %v", c.Precision)
+	case c.SweepVariable == SweepSamplesPerNode && c.SamplesPerNode != nil:
+		return fmt.Errorf("SamplesPerNode cannot be set when sweeping samples per node")
+	case c.CheckpointPath != "" && c.SamplesPerNode != nil:
+		return fmt.Errorf("SamplesPerNode cannot be stored in a checkpoint")
+	case c.CheckpointPath != "" && !checkpointable(c.Distribution):
+		return fmt.Errorf("Distribution %T cannot be stored in a checkpoint", c.Distribution)
+	case c.SizeIterFactor <= 0:
+		return fmt.Errorf("SizeIterFactor must be positive, got %d", c.SizeIterFactor)
+	case c.MaxLights < 0:
+		return fmt.Errorf("MaxLights must not be negative, got %d", c.MaxLights)
+	case c.TargetProbability <= 0 || c.TargetProbability > 1:
+		return fmt.Errorf("TargetProbability must be in (0,1], got %v", c.TargetProbability)
+	case !slices.IsSorted(c.TargetProbabilities):
+		return fmt.Errorf("TargetProbabilities must be in ascending order, got %v", c.TargetProbabilities)
+	case c.RecoveryThreshold < 0 || c.RecoveryThreshold > 2*c.minSize():
+		return fmt.Errorf("RecoveryThreshold must be 0 or between 1 and %d, got %d", 2*c.minSize(), c.RecoveryThreshold)
+	case c.WithheldFraction < 0 || c.WithheldFraction >= 1:
+		return fmt.Errorf("WithheldFraction must be in [0,1), got %v", c.WithheldFraction)
+	case c.WithheldColumns < 0 || c.WithheldColumns > 2*c.minSize():
+		return fmt.Errorf("WithheldColumns must be between 0 and %d, got %d", 2*c.minSize(), c.WithheldColumns)
+	case c.LossProbability < 0 || c.LossProbability >= 1:
+		return fmt.Errorf("LossProbability must be in [0,1), got %v", c.LossProbability)
+	}
+	for i, model := range c.CompareModels {
+		if slices.Contains(c.CompareModels[:i], model) {
+			return fmt.Errorf("CompareModels must not repeat a model, got %s twice", model)
+		}
+	}
+	for _, target := range c.TargetProbabilities {
+		if target <= 0 || target > 1 {
+			return fmt.Errorf("TargetProbabilities must be in (0,1], got %v", target)
+		}
+	}
+	for _, size := range c.sizes() {
+		switch {
+		case c.sampleableCells(size) == 0:
+			return fmt.Errorf("Distribution cannot sample any cell of the %s sample region at size %d", c.SampleRegion, size)
+		case c.SweepVariable == SweepSamplesPerNode && c.SamplesPerIteration > c.sampleableCells(size):
+			return fmt.Errorf("SamplesPerIteration %d exceeds the %d sampleable cells of size %d", c.SamplesPerIteration, c.sampleableCells(size), size)
+		case c.SweepVariable == SweepLights && c.InitialLightsFor(size) > c.maxLights(size):
+			// the search would end without probing anything
+			return fmt.Errorf("initial lights %d of size %d exceed MaxLights %d", c.InitialLightsFor(size), size, c.maxLights(size))
+		}
+	}
+	return nil
+}
+
+// isPowerOfTwo reports whether n is a positive power of two
+func isPowerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+// logf logs through the standard logger when verbose output is enabled
+func (c *SimulationConfig) logf(format string, args ...any) {
+	if c.Verbose {
+		log.Printf(format, args...)
+	}
+}
+
+// models returns the sampling models to sweep, in order
+func (c *SimulationConfig) models() []SamplingModel {
+	if len(c.CompareModels) > 0 {
+		return c.CompareModels
+	}
+	return []SamplingModel{c.SamplingModel}
+}
+
+// modelPrefix labels log lines with model when comparing sampling models
+func (c *SimulationConfig) modelPrefix(model SamplingModel) string {
+	if len(c.CompareModels) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Model: %s, ", model)
+}
+
+// sizes returns the data square sizes to simulate, in order
+func (c *SimulationConfig) sizes() []int {
+	if len(c.Sizes) > 0 {
+		return c.Sizes
+	}
+
+	var sizes []int
+	for size := c.InitialSize; size <= c.MaxSize; size *= 2 {
+		sizes = append(sizes, size)
+	}
+	return sizes
+}
+
+// minSize returns the smallest size to simulate
+func (c *SimulationConfig) minSize() int {
+	if len(c.Sizes) > 0 {
+		return slices.Min(c.Sizes)
+	}
+	return c.InitialSize
+}
+
+// InitialLightsFor returns the lights count the search of size starts from,
+// which stays fixed with SweepSamplesPerNode. The cells of OneD grow
+// linearly with size, so LightsAt16 scales linearly for it.
+func (c *SimulationConfig) InitialLightsFor(size int) int {
+	switch {
+	case c.LightsAt16 == 0:
+		return c.InitialLights
+	case c.Dimension == OneD:
+		return max(c.LightsAt16*size/16, 1)
+	default:
+		return c.LightsAt16 * (size * size) / (16 * 16)
+	}
+}
+
+// targets returns the target probabilities in ascending order, the last of
+// which ends the search of each size
+func (c *SimulationConfig) targets() []float64 {
+	if len(c.TargetProbabilities) > 0 {
+		return c.TargetProbabilities
+	}
+	return []float64{c.TargetProbability}
+}
+
+// distribution returns the configured sampling distribution, defaulting to
+// uniform and restricted to the configured SampleRegion and Dimension
+func (c *SimulationConfig) distribution() Distribution {
+	dist := c.Distribution
+	if dist == nil {
+		dist = UniformDistribution{}
+	}
+	if c.SampleRegion == OriginalBlock {
+		dist = originalBlock{dist}
+	}
+	if c.Dimension == OneD {
+		dist = vector{dist}
+	}
+	return dist
+}
+
+// withholdDistribution returns the distribution of the withheld cells,
+// which are uniform over the extended data
+func (c *SimulationConfig) withholdDistribution() Distribution {
+	if c.Dimension == OneD {
+		return vector{UniformDistribution{}}
+	}
+	return UniformDistribution{}
+}
+
+// extendedCells returns the number of cells of the extended data for size
+func (c *SimulationConfig) extendedCells(size int) int {
+	if c.Dimension == OneD {
+		return 2 * size
+	}
+	return 4 * size * size
+}
+
+// sampleableCells returns the number of cells light nodes may sample for size,
+// within the sample region and the sub-block of a ClusteredDistribution
+// that never samples outside it
+func (c *SimulationConfig) sampleableCells(size int) int {
+	lo, hi := 0, 2*size
+	if c.SampleRegion == OriginalBlock {
+		hi = size
+	}
+	if d, ok := c.Distribution.(ClusteredDistribution); ok && d.Weight >= 1 {
+		origin, extent := d.block(size)
+		lo, hi = max(lo, origin), min(hi, origin+extent)
+	}
+
+	side := max(hi-lo, 0)
+	if c.Dimension == OneD {
+		return side
+	}
+	return side * side
+}
+
+// lightsStep returns the lights increment of the linear search for size
+func (c *SimulationConfig) lightsStep(size int) int {
+	return max(1, size/c.SizeIterFactor)
+}
+
+// maxLights returns the largest lights count probed for size
+func (c *SimulationConfig) maxLights(size int) int {
+	if c.MaxLights == 0 {
+		return 4 * size * size
+	}
+	return c.MaxLights
+}
+
+// recoveryThreshold returns the row and column recovery threshold for size
+func (c *SimulationConfig) recoveryThreshold(size int) int {
+	if c.RecoveryThreshold == 0 {
+		return size
+	}
+	return c.RecoveryThreshold
+}
+
+// resolveSeed returns the configured seed, or a time-based one when Seed is 0,
+// and logs it so the run can be replayed
+func (c *SimulationConfig) resolveSeed() int64 {
+	seed := c.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	c.logf("Using seed: %d\n", seed)
+	return seed
+}
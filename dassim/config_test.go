@@ -0,0 +1,55 @@
+package dassim
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateRejectsDuplicates(t *testing.T) {
+	config := NewDefaultConfig()
+	config.Sizes = []int{16, 32, 16}
+	if err := config.Validate(); err == nil {
+		t.Fatal("Validate accepted a repeated size")
+	}
+
+	config = NewDefaultConfig()
+	config.CompareModels = []SamplingModel{PerNode, SharedUnique, PerNode}
+	if err := config.Validate(); err == nil {
+		t.Fatal("Validate accepted a repeated sampling model")
+	}
+}
+
+func TestValidateChecksSizesFirst(t *testing.T) {
+	config := NewDefaultConfig()
+	config.Sizes = []int{-4}
+	err := config.Validate()
+	if err == nil || !strings.HasPrefix(err.Error(), "Sizes") {
+		t.Fatalf("Validate returned %v, want an error about Sizes", err)
+	}
+}
+
+func TestValidateRejectsNegativeCounts(t *testing.T) {
+	for name, set := range map[string]func(*SimulationConfig){
+		"InitialLights":   func(c *SimulationConfig) { c.LightsAt16, c.InitialLights = 0, -1 },
+		"LightsAt16":      func(c *SimulationConfig) { c.LightsAt16 = -1 },
+		"MaxIterations":   func(c *SimulationConfig) { c.MaxIterations = -1 },
+		"ParallelSizes":   func(c *SimulationConfig) { c.ParallelSizes = -1 },
+		"Repeats":         func(c *SimulationConfig) { c.Repeats = -1 },
+		"CheckpointEvery": func(c *SimulationConfig) { c.CheckpointEvery = -1 },
+	} {
+		config := NewDefaultConfig()
+		set(config)
+		if err := config.Validate(); err == nil || !strings.HasPrefix(err.Error(), name) {
+			t.Errorf("Validate returned %v for a negative %s", err, name)
+		}
+	}
+}
+
+func TestValidateRejectsCapBelowStart(t *testing.T) {
+	config := NewDefaultConfig()
+	config.MaxSize = 64
+	config.MaxLights = 100
+	if err := config.Validate(); err == nil {
+		t.Fatal("Validate accepted MaxLights below the initial lights of size 64")
+	}
+}
@@ -0,0 +1,44 @@
+package dassim
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// maxCorpusRetries bounds how many duplicate patterns GenerateCorpus tolerates
+// before giving up on finding another distinct one
+const maxCorpusRetries = 1000
+
+// GenerateCorpus produces count distinct sample patterns for a square of the
+// given size, each covering density percent of the extended 2k x 2k square.
+// The patterns are fully determined by seed, so the same arguments always
+// yield the same corpus. Fewer than count patterns are returned if no more
+// distinct patterns can be found at that density, and none for a count
+// below 1.
+func GenerateCorpus(size, density, count int, seed int64) [][]Sample {
+	rng := rand.New(rand.NewSource(seed))
+	cells := 4 * size * size
+	n := min(max(density, 0), 100) * cells / 100
+	count = max(count, 0)
+
+	corpus := make([][]Sample, 0, count)
+	seen := make(map[string]bool, count)
+	samples := NewSampleSet(n)
+
+	for retries := 0; len(corpus) < count && retries < maxCorpusRetries; {
+		samples.Clear()
+		samples.FillUnique(n, size, rng, UniformDistribution{})
+
+		pattern := samples.Sorted()
+		key := fmt.Sprint(pattern)
+		if seen[key] {
+			retries++
+			continue
+		}
+
+		seen[key] = true
+		corpus = append(corpus, pattern)
+		retries = 0
+	}
+	return corpus
+}
@@ -0,0 +1,26 @@
+package dassim
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGenerateCorpusIsDeterministic(t *testing.T) {
+	first := GenerateCorpus(8, 30, 20, 7)
+	second := GenerateCorpus(8, 30, 20, 7)
+	if len(first) != 20 {
+		t.Fatalf("got %d patterns, want 20", len(first))
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Fatal("two corpora generated from the same seed differ")
+	}
+	if reflect.DeepEqual(first, GenerateCorpus(8, 30, 20, 8)) {
+		t.Fatal("corpora generated from different seeds are identical")
+	}
+}
+
+func TestGenerateCorpusAcceptsNegativeCount(t *testing.T) {
+	if corpus := GenerateCorpus(8, 30, -1, 7); len(corpus) != 0 {
+		t.Fatalf("got %d patterns for a negative count, want none", len(corpus))
+	}
+}
@@ -0,0 +1,71 @@
+package dassim
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Dimension selects the erasure coding scheme whose recovery is simulated
+type Dimension int
+
+const (
+	// TwoD extends the k x k original data to a 2k x 2k square that is
+	// recovered row by row and column by column
+	TwoD Dimension = iota
+
+	// OneD extends k original cells to a single vector of 2k cells that is
+	// recovered once the recovery threshold of its cells is present, as a
+	// baseline for the 2D scheme
+	OneD
+)
+
+// String returns the name used for the dimension on the command line
+func (d Dimension) String() string {
+	switch d {
+	case TwoD:
+		return "2d"
+	case OneD:
+		return "1d"
+	default:
+		return fmt.Sprintf("Dimension(%d)", int(d))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (d Dimension) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (d *Dimension) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "2d":
+		*d = TwoD
+	case "1d":
+		*d = OneD
+	default:
+		return fmt.Errorf("unknown dimension %q", text)
+	}
+	return nil
+}
+
+// newDataVector creates the single row of 2k cells simulated by OneD, which
+// is recovered once threshold cells are present
+func newDataVector(size, threshold int) *DataSquare {
+	ds := newRegion(2*size, 1)
+	ds.RowThreshold = threshold
+	ds.ColThreshold = 1
+	return ds
+}
+
+// vector restricts a Distribution to the single row of a OneD vector,
+// keeping only the column of each sampled cell
+type vector struct {
+	Distribution
+}
+
+// Sample implements Distribution
+func (d vector) Sample(rng *rand.Rand, size int) (row, col int) {
+	_, col = d.Distribution.Sample(rng, size)
+	return 0, col
+}
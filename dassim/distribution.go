@@ -0,0 +1,116 @@
+package dassim
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Distribution picks the cells that light nodes sample
+type Distribution interface {
+	// Sample returns a random cell of the extended 2*size x 2*size square
+	Sample(rng *rand.Rand, size int) (row, col int)
+}
+
+// UniformDistribution samples every cell of the extended square with equal probability
+type UniformDistribution struct{}
+
+// Sample implements Distribution
+func (UniformDistribution) Sample(rng *rand.Rand, size int) (row, col int) {
+	return rng.Intn(size * 2), rng.Intn(size * 2)
+}
+
+// ClusteredDistribution concentrates sampling in a square sub-block of the
+// extended square, modelling nodes that favor certain namespaces
+type ClusteredDistribution struct {
+	// Origin and Extent place the sub-block as fractions of the extended width 2*size
+	// For example Origin 0 and Extent 0.5 select the original data quadrant
+	Origin float64 `json:"origin"`
+	Extent float64 `json:"extent"`
+
+	// Weight is the probability that a sample is drawn from the sub-block
+	// Other samples are drawn uniformly from the whole square. A Weight of 1
+	// never samples outside the sub-block, so the unique samples of a light
+	// node are capped at the cells it holds.
+	Weight float64 `json:"weight"`
+}
+
+// Sample implements Distribution
+func (d ClusteredDistribution) Sample(rng *rand.Rand, size int) (row, col int) {
+	if rng.Float64() >= d.Weight {
+		return UniformDistribution{}.Sample(rng, size)
+	}
+
+	origin, extent := d.block(size)
+	return origin + rng.Intn(extent), origin + rng.Intn(extent)
+}
+
+// block returns the first row and column of the sub-block and its side
+func (d ClusteredDistribution) block(size int) (origin, extent int) {
+	width := size * 2
+	origin = min(int(d.Origin*float64(width)), width-1)
+	extent = min(max(int(d.Extent*float64(width)), 1), width-origin)
+	return origin, extent
+}
+
+// SampleRegion selects which part of the extended square light nodes sample
+type SampleRegion int
+
+const (
+	// FullSquare samples the whole 2k x 2k extended square
+	FullSquare SampleRegion = iota
+
+	// OriginalBlock samples only the original k x k data quadrant
+	// Recovery still applies to the full extended square
+	OriginalBlock
+)
+
+// String returns the name used for the region on the command line
+func (r SampleRegion) String() string {
+	switch r {
+	case FullSquare:
+		return "full"
+	case OriginalBlock:
+		return "original"
+	default:
+		return fmt.Sprintf("SampleRegion(%d)", int(r))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (r SampleRegion) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (r *SampleRegion) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "full":
+		*r = FullSquare
+	case "original":
+		*r = OriginalBlock
+	default:
+		return fmt.Errorf("unknown sample region %q", text)
+	}
+	return nil
+}
+
+// originalBlock restricts a Distribution to the original k x k quadrant
+type originalBlock struct {
+	Distribution
+}
+
+// Sample implements Distribution, drawing uniform cells directly and
+// rejecting cells of any other distribution that fall outside the quadrant
+// Validate rejects a ClusteredDistribution that can never land inside it.
+func (d originalBlock) Sample(rng *rand.Rand, size int) (row, col int) {
+	if _, ok := d.Distribution.(UniformDistribution); ok {
+		return rng.Intn(size), rng.Intn(size)
+	}
+
+	for {
+		row, col = d.Distribution.Sample(rng, size)
+		if row < size && col < size {
+			return row, col
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package dassim
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUniqueSamplingFitsNarrowCluster(t *testing.T) {
+	for _, model := range []SamplingModel{PerNode, SharedUnique} {
+		config := NewDefaultConfig()
+		config.Iterations = 10
+		config.SamplingModel = model
+		// a single cell, fewer than the samples of a light node
+		config.Distribution = ClusteredDistribution{Origin: 0, Extent: 0.01, Weight: 1}
+
+		stats, err := runProbe(context.Background(), config, 16, 4, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.distinct != stats.iterations {
+			t.Fatalf("%s placed %d cells over %d trials, want 1 per trial", model, stats.distinct, stats.iterations)
+		}
+	}
+}
+
+func TestValidateRejectsClusterOutsideOriginalBlock(t *testing.T) {
+	config := NewDefaultConfig()
+	config.SampleRegion = OriginalBlock
+	config.Distribution = ClusteredDistribution{Origin: 0.5, Extent: 0.25, Weight: 1}
+	if err := config.Validate(); err == nil {
+		t.Fatal("Validate accepted a cluster that never samples the original block")
+	}
+
+	config.Distribution = ClusteredDistribution{Origin: 0.25, Extent: 0.5, Weight: 1}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate rejected a cluster overlapping the original block: %v", err)
+	}
+}
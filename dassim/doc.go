@@ -0,0 +1,8 @@
+// Package dassim simulates Data Availability Sampling reconstruction of a
+// 2D Reed-Solomon extended data square.
+//
+// Light nodes place random samples into a 2k x 2k DataSquare, which is then
+// recovered by repeatedly reconstructing any row or column that holds at
+// least k samples. RunSimulation sweeps square sizes and light node counts to
+// find the number of light nodes needed to recover with a target probability.
+package dassim
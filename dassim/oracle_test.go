@@ -0,0 +1,149 @@
+package dassim
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// bruteForceRecoverable is a reference implementation of recovery used to
+// check RecoverSquare. It fills every row and column meeting threshold until
+// nothing changes, without any of the bookkeeping or early exits of
+// DataSquare.Recover, and reports whether the whole matrix got filled along
+// with the filled matrix.
+func bruteForceRecoverable(matrix [][]int, threshold int) (bool, [][]int) {
+	filled := make([][]int, len(matrix))
+	for row := range matrix {
+		filled[row] = make([]int, len(matrix[row]))
+		for col, v := range matrix[row] {
+			if v != 0 {
+				filled[row][col] = 1
+			}
+		}
+	}
+	if len(filled) == 0 {
+		return true, filled
+	}
+	rows, cols := len(filled), len(filled[0])
+
+	for changed := true; changed; {
+		changed = false
+		for row := 0; row < rows; row++ {
+			n := 0
+			for col := 0; col < cols; col++ {
+				n += filled[row][col]
+			}
+			if n >= threshold && n < cols {
+				for col := 0; col < cols; col++ {
+					filled[row][col] = 1
+				}
+				changed = true
+			}
+		}
+		for col := 0; col < cols; col++ {
+			n := 0
+			for row := 0; row < rows; row++ {
+				n += filled[row][col]
+			}
+			if n >= threshold && n < rows {
+				for row := 0; row < rows; row++ {
+					filled[row][col] = 1
+				}
+				changed = true
+			}
+		}
+	}
+
+	for row := range filled {
+		if slices.Contains(filled[row], 0) {
+			return false, filled
+		}
+	}
+	return true, filled
+}
+
+// randomMatrix returns a random extended matrix of a small random size with
+// a random density of present cells, and a random recovery threshold
+func randomMatrix(rng *rand.Rand) (matrix [][]int, threshold int) {
+	size := 1 + rng.Intn(4)
+	threshold = 1 + rng.Intn(2*size)
+	density := rng.Float64()
+
+	matrix = make([][]int, 2*size)
+	for row := range matrix {
+		matrix[row] = make([]int, 2*size)
+		for col := range matrix[row] {
+			if rng.Float64() < density {
+				matrix[row][col] = 1
+			}
+		}
+	}
+	return matrix, threshold
+}
+
+func TestRecoverSquareMatchesOracle(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		matrix, threshold := randomMatrix(rng)
+
+		recovered, ok := RecoverSquare(matrix, threshold)
+		wantOK, want := bruteForceRecoverable(matrix, threshold)
+		if ok != wantOK || !equalMatrix(recovered, want) {
+			t.Fatalf("threshold %d: RecoverSquare ok=%v, brute force ok=%v for matrix %v",
+				threshold, ok, wantOK, matrix)
+		}
+	}
+}
+
+func TestIncrementalRecoveryMatchesOracle(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		matrix, threshold := randomMatrix(rng)
+
+		ok, cells := recoverIncremental(t, matrix, threshold, rng)
+		wantOK, want := bruteForceRecoverable(matrix, threshold)
+		if ok != wantOK || !equalMatrix(cells, want) {
+			t.Fatalf("threshold %d: incremental ok=%v, brute force ok=%v for matrix %v",
+				threshold, ok, wantOK, matrix)
+		}
+	}
+}
+
+// recoverIncremental adds the present cells of matrix to an Incremental
+// square in random order and returns whether it recovered and its cells
+func recoverIncremental(t *testing.T, matrix [][]int, threshold int, rng *rand.Rand) (bool, [][]int) {
+	ds := newRegion(len(matrix[0]), len(matrix))
+	ds.Incremental = true
+	if err := ds.SetRecoveryThreshold(threshold); err != nil {
+		t.Fatal(err)
+	}
+
+	var present []Sample
+	for row := range matrix {
+		for col, v := range matrix[row] {
+			if v != 0 {
+				present = append(present, Sample{Row: row, Col: col})
+			}
+		}
+	}
+	rng.Shuffle(len(present), func(i, j int) { present[i], present[j] = present[j], present[i] })
+	for _, s := range present {
+		ds.AddSample(s.Row, s.Col)
+	}
+
+	cells := make([][]int, len(matrix))
+	for row := range cells {
+		cells[row] = make([]int, len(matrix[row]))
+		for col := range cells[row] {
+			if ds.Get(row, col) {
+				cells[row][col] = 1
+			}
+		}
+	}
+	return ds.IsRecovered(), cells
+}
+
+// equalMatrix reports whether a and b hold the same cells
+func equalMatrix(a, b [][]int) bool {
+	return slices.EqualFunc(a, b, func(x, y []int) bool { return slices.Equal(x, y) })
+}
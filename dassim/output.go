@@ -0,0 +1,114 @@
+package dassim
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// WriteCSV writes one row per probe point in results to w, preceded by a header row
+func WriteCSV(w io.Writer, results []SimulationResult) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"model", "size", "lights", "samples_per_iteration", "success_count", "iterations", "probability"}); err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		record := []string{
+			r.Model.String(),
+			strconv.Itoa(r.Size),
+			strconv.Itoa(r.Lights),
+			strconv.Itoa(r.SamplesPerIteration),
+			strconv.Itoa(r.SuccessCount),
+			strconv.Itoa(r.Iterations),
+			strconv.FormatFloat(r.Probability, 'f', 6, 64),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteAggregateCSV writes one row per model and size in aggregates to w,
+// preceded by a header row
+func WriteAggregateCSV(w io.Writer, aggregates []AggregateResult) error {
+	cw := csv.NewWriter(w)
+	header := []string{"model", "size", "repeats", "reached", "mean_lights", "stddev_lights",
+		"min_lights", "max_lights", "p5_lights", "p50_lights", "p95_lights"}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, a := range aggregates {
+		record := []string{
+			a.Model.String(),
+			strconv.Itoa(a.Size),
+			strconv.Itoa(a.Repeats),
+			strconv.Itoa(a.Reached),
+			strconv.FormatFloat(a.MeanLights, 'f', 6, 64),
+			strconv.FormatFloat(a.StdDevLights, 'f', 6, 64),
+			strconv.Itoa(a.MinLights),
+			strconv.Itoa(a.MaxLights),
+			strconv.Itoa(a.P5Lights),
+			strconv.Itoa(a.P50Lights),
+			strconv.Itoa(a.P95Lights),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// jsonReport is the document written by WriteJSON
+type jsonReport struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	Config      jsonConfig         `json:"config"`
+	Results     []SimulationResult `json:"results"`
+
+	// Aggregates summarizes the thresholds across repeats when Repeats is set
+	Aggregates []AggregateResult `json:"aggregates,omitempty"`
+}
+
+// jsonConfig is the effective configuration of a run, with the seed
+// resolved and the starting lights count of every size spelled out
+type jsonConfig struct {
+	SimulationConfig
+	SizeInitialLights map[int]int `json:"size_initial_lights"`
+}
+
+// WriteJSON writes results to w as a JSON document together with the
+// effective config they were produced with, and their Aggregate when the
+// sweep was repeated
+func WriteJSON(w io.Writer, config *SimulationConfig, results []SimulationResult) error {
+	effective := jsonConfig{
+		SimulationConfig:  *config,
+		SizeInitialLights: make(map[int]int),
+	}
+	if effective.Seed == 0 && len(results) > 0 {
+		effective.Seed = results[0].Seed
+	}
+	for _, size := range config.sizes() {
+		effective.SizeInitialLights[size] = config.InitialLightsFor(size)
+	}
+
+	report := jsonReport{
+		GeneratedAt: time.Now().UTC(),
+		Config:      effective,
+		Results:     results,
+	}
+	if config.Repeats > 1 {
+		report.Aggregates = Aggregate(results)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,102 @@
+package dassim
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// glyphs are the characters Render draws for each CellState
+var glyphs = [...]byte{
+	CellMissing:   '.',
+	CellWithheld:  'x',
+	CellSampled:   '#',
+	CellRecovered: '+',
+}
+
+// cellPalette holds the colors WritePNG paints for each CellState
+var cellPalette = color.Palette{
+	CellMissing:   color.RGBA{0xe0, 0xe0, 0xe0, 0xff},
+	CellWithheld:  color.RGBA{0xd0, 0x30, 0x30, 0xff},
+	CellSampled:   color.RGBA{0x20, 0x40, 0xa0, 0xff},
+	CellRecovered: color.RGBA{0x40, 0xb0, 0x60, 0xff},
+}
+
+// pngTargetWidth is the approximate image width WritePNG aims for when
+// picking the pixel block of each cell
+const pngTargetWidth = 512
+
+// Render writes the region as text, one line per row, preceded by a column
+// header. Sampled cells are drawn as '#', cells reconstructed by row or
+// column recovery as '+', missing cells as '.' and missing withheld cells
+// as 'x'. It is meant for eyeballing small squares, up to about size 32.
+func (ds *DataSquare) Render(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	labelWidth := len(fmt.Sprint(ds.ColLen - 1))
+
+	// column indices are written vertically, one digit per header line
+	div := 1
+	for div*10 <= ds.RowLen-1 {
+		div *= 10
+	}
+	for ; div >= 1; div /= 10 {
+		bw.WriteString(strings.Repeat(" ", labelWidth+1))
+		for col := 0; col < ds.RowLen; col++ {
+			if col < div && div > 1 {
+				bw.WriteByte(' ')
+			} else {
+				bw.WriteByte(byte('0' + col/div%10))
+			}
+		}
+		bw.WriteByte('\n')
+	}
+
+	for row := 0; row < ds.ColLen; row++ {
+		fmt.Fprintf(bw, "%*d ", labelWidth, row)
+		for col := 0; col < ds.RowLen; col++ {
+			bw.WriteByte(glyphs[ds.Provenance(row, col)])
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// String renders the region as text, see Render
+func (ds *DataSquare) String() string {
+	var sb strings.Builder
+	ds.Render(&sb)
+	return sb.String()
+}
+
+// WritePNG writes the region to w as a PNG heatmap, painting sampled cells
+// blue, recovered cells green, missing cells gray and missing withheld cells
+// red. Each cell is scaled to a pixel block chosen so the image is about
+// 512 pixels wide; use WritePNGScaled to pick the block size.
+func (ds *DataSquare) WritePNG(w io.Writer) error {
+	return ds.WritePNGScaled(w, max(1, pngTargetWidth/max(ds.RowLen, ds.ColLen)))
+}
+
+// WritePNGScaled is like WritePNG but paints every cell as a block of
+// block x block pixels
+func (ds *DataSquare) WritePNGScaled(w io.Writer, block int) error {
+	if block < 1 {
+		return fmt.Errorf("pixel block must be positive, got %d", block)
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, ds.RowLen*block, ds.ColLen*block), cellPalette)
+	for row := 0; row < ds.ColLen; row++ {
+		for col := 0; col < ds.RowLen; col++ {
+			state := uint8(ds.Provenance(row, col))
+			for y := row * block; y < (row+1)*block; y++ {
+				for x := col * block; x < (col+1)*block; x++ {
+					img.SetColorIndex(x, y, state)
+				}
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
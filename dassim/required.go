@@ -0,0 +1,103 @@
+package dassim
+
+import (
+	"context"
+	"math"
+	"slices"
+)
+
+// RequiredLightsResult describes how many light nodes the trials of a single
+// size needed before the square first became recoverable
+type RequiredLightsResult struct {
+	Size   int `json:"size"`
+	Trials int `json:"trials"`
+
+	// Histogram maps every lights count to the number of trials that first
+	// recovered with it. Unrecovered counts the trials that did not recover
+	// within the configured MaxLights.
+	Histogram   map[int]int `json:"histogram"`
+	Unrecovered int         `json:"unrecovered"`
+
+	// P50, P90 and P99 are percentiles of the required lights count over
+	// all trials. A percentile that falls among the unrecovered trials is 0.
+	P50 int `json:"p50"`
+	P90 int `json:"p90"`
+	P99 int `json:"p99"`
+}
+
+// RunRequiredLights measures, for every configured size, the distribution of
+// the number of light nodes needed to recover the square. Each of the
+// config.Iterations trials adds one light node at a time and checks for
+// recovery after each, up to the configured MaxLights. It returns an error
+// when the config is invalid.
+func RunRequiredLights(config *SimulationConfig) ([]RequiredLightsResult, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	seed := config.resolveSeed()
+
+	var results []RequiredLightsResult
+	for _, size := range config.sizes() {
+		maxLights := config.maxLights(size)
+		required := make([]int, config.Iterations)
+		forEachTrial(context.Background(), config, size, deriveSeed(seed, int64(size)), 0, config.Iterations, func(t *trialState, i int) {
+			required[i] = t.requiredLights(config, maxLights)
+		})
+
+		result := RequiredLightsResult{
+			Size:      size,
+			Trials:    config.Iterations,
+			Histogram: make(map[int]int),
+		}
+		for i, lights := range required {
+			if lights == 0 {
+				// unrecovered trials rank above every recovered one
+				result.Unrecovered++
+				required[i] = math.MaxInt
+				continue
+			}
+			result.Histogram[lights]++
+		}
+
+		slices.Sort(required)
+		result.P50 = requiredPercentile(required, 0.5)
+		result.P90 = requiredPercentile(required, 0.9)
+		result.P99 = requiredPercentile(required, 0.99)
+		config.logf("Size: %d, P50: %d, P90: %d, P99: %d lights (%d/%d unrecovered)\n",
+			size, result.P50, result.P90, result.P99, result.Unrecovered, result.Trials)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// requiredPercentile returns the p-th percentile of the sorted required
+// lights counts, or 0 when it falls among the unrecovered trials
+func requiredPercentile(sorted []int, p float64) int {
+	if v := percentile(sorted, p); v != math.MaxInt {
+		return v
+	}
+	return 0
+}
+
+// requiredLights resets the square and adds light nodes one at a time until
+// the square is recoverable, returning how many were needed, or 0 when
+// maxLights nodes were not enough. The square recovers incrementally, so
+// checking after every node costs no more than a single Recover.
+func (t *trialState) requiredLights(config *SimulationConfig, maxLights int) int {
+	t.reset(config)
+	t.ds.Incremental = true
+	defer func() { t.ds.Incremental = false }()
+
+	dist := config.distribution()
+	for lights := 1; lights <= maxLights; lights++ {
+		if config.SamplingModel == SharedUnique {
+			t.addSharedNode(config, dist)
+		} else {
+			t.addNode(config, dist)
+		}
+		if t.ds.IsRecovered() {
+			return lights
+		}
+	}
+	return 0
+}
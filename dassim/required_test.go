@@ -0,0 +1,11 @@
+package dassim
+
+import "testing"
+
+func TestRunRequiredLightsRejectsInvalidConfig(t *testing.T) {
+	config := NewDefaultConfig()
+	config.InitialSize = 0
+	if _, err := RunRequiredLights(config); err == nil {
+		t.Fatal("RunRequiredLights accepted a config with InitialSize 0")
+	}
+}
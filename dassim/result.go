@@ -0,0 +1,340 @@
+package dassim
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// SimulationResult holds the outcome of running all iterations for a single
+// size and lights count
+type SimulationResult struct {
+	Size         int     `json:"size"`
+	Lights       int     `json:"lights"`
+	SuccessCount int     `json:"success_count"`
+	Iterations   int     `json:"iterations"` // trials actually run, which varies with AdaptiveIterations
+	Probability  float64 `json:"probability"`
+
+	// Repeat is the index of the sweep the result belongs to when Repeats is set
+	Repeat int `json:"repeat"`
+
+	// Model is the sampling model of the sweep, which varies with CompareModels
+	Model SamplingModel `json:"model"`
+
+	// Seed is the resolved base seed the trials were sampled from
+	Seed int64 `json:"seed"`
+
+	// WithheldFraction is the fraction of cells withheld in every trial
+	WithheldFraction float64 `json:"withheld_fraction"`
+
+	// LowerBound and UpperBound are the 95% Wilson score interval of Probability
+	LowerBound float64 `json:"lower_bound"`
+	UpperBound float64 `json:"upper_bound"`
+
+	// Duration is the wall-clock time spent running the trials
+	Duration time.Duration `json:"duration"`
+
+	// SamplesPerIteration is the configured number of samples per light node
+	// of the probe, which is searched with SweepSamplesPerNode
+	SamplesPerIteration int `json:"samples_per_iteration"`
+
+	// MeanSamplesPerNode is the average number of samples each light node
+	// requested, which differs from SamplesPerIteration when SamplesPerNode is set
+	MeanSamplesPerNode float64 `json:"mean_samples_per_node"`
+
+	// RequestedSamples is the average number of samples all light nodes
+	// requested per trial and DistinctSamples the average number of distinct
+	// cells they placed before recovery. CoverageEfficiency is their ratio,
+	// which falls as more samples collide with already placed cells.
+	RequestedSamples   float64 `json:"requested_samples"`
+	DistinctSamples    float64 `json:"distinct_samples"`
+	CoverageEfficiency float64 `json:"coverage_efficiency"`
+
+	// RoundStats summarizes the recovery rounds of the successful trials
+	RoundStats RoundStats `json:"round_stats"`
+
+	// Target is the configured TargetProbability, or the highest of
+	// TargetProbabilities when set, and Reached reports whether the
+	// probability met it
+	// The lower bound is compared instead when ConservativeThreshold is set
+	Target  float64 `json:"target"`
+	Reached bool    `json:"reached"`
+
+	// ReachedTargets lists the configured target probabilities the result met
+	ReachedTargets []float64 `json:"reached_targets,omitempty"`
+}
+
+// RoundStats holds the minimum, maximum and mean propagation depth, the
+// waves of RecoveryStats.Rounds, the successful trials of a probe needed, all
+// 0 when none succeeded. Many rounds near the threshold mean recovery hinges
+// on long propagation chains.
+type RoundStats struct {
+	Min  int     `json:"min"`
+	Max  int     `json:"max"`
+	Mean float64 `json:"mean"`
+}
+
+// newResult builds the result of the trials accumulated in stats for the
+// given size and lights count, sampled from seed
+func (c *SimulationConfig) newResult(size, lights int, stats probeStats, seed int64) SimulationResult {
+	successCount, iterations := stats.successCount, stats.iterations
+	probability := float64(successCount) / float64(iterations)
+	lower, upper := WilsonInterval(successCount, iterations, z95)
+
+	estimate := probability
+	if c.ConservativeThreshold {
+		estimate = lower
+	}
+
+	targets := c.targets()
+	var reached []float64
+	for _, target := range targets {
+		if estimate >= target {
+			reached = append(reached, target)
+		}
+	}
+
+	var rounds RoundStats
+	if successCount > 0 {
+		rounds = RoundStats{
+			Min:  stats.minRounds,
+			Max:  stats.maxRounds,
+			Mean: float64(stats.totalRounds) / float64(successCount),
+		}
+	}
+
+	var efficiency float64
+	if stats.samples > 0 {
+		efficiency = float64(stats.distinct) / float64(stats.samples)
+	}
+
+	return SimulationResult{
+		Size:                size,
+		Lights:              lights,
+		SuccessCount:        successCount,
+		Iterations:          iterations,
+		Probability:         probability,
+		Model:               c.SamplingModel,
+		Seed:                seed,
+		WithheldFraction:    c.WithheldFraction,
+		LowerBound:          lower,
+		UpperBound:          upper,
+		Target:              targets[len(targets)-1],
+		Reached:             len(reached) == len(targets),
+		SamplesPerIteration: c.SamplesPerIteration,
+		MeanSamplesPerNode:  meanSamplesPerNode(stats.samples, lights, iterations),
+		RequestedSamples:    float64(stats.samples) / float64(iterations),
+		DistinctSamples:     float64(stats.distinct) / float64(iterations),
+		CoverageEfficiency:  efficiency,
+		RoundStats:          rounds,
+		ReachedTargets:      reached,
+	}
+}
+
+// meanSamplesPerNode returns the average samples per light node of a probe,
+// or 0 when it had no light nodes
+func meanSamplesPerNode(samples, lights, iterations int) float64 {
+	if lights == 0 || iterations == 0 {
+		return 0
+	}
+	return float64(samples) / float64(lights*iterations)
+}
+
+// ThresholdResult holds the lights count that first reached the target
+// probability for a single size
+type ThresholdResult struct {
+	Model   SamplingModel `json:"model"`
+	Repeat  int           `json:"repeat"`
+	Size    int           `json:"size"`
+	Lights  int           `json:"lights"`
+	Reached bool          `json:"reached"`
+
+	// SamplesPerIteration is the samples per light node of the threshold,
+	// the searched quantity with SweepSamplesPerNode
+	SamplesPerIteration int `json:"samples_per_iteration"`
+
+	// InterpolatedThreshold estimates the fractional lights count at which
+	// the success probability equals the target, interpolating linearly
+	// between the largest failing and the smallest passing probe. It equals
+	// Lights when no smaller lights count was probed and is 0 when the
+	// target was not reached.
+	InterpolatedThreshold float64 `json:"interpolated_threshold"`
+
+	// TotalRequests is the mean number of samples all light nodes requested
+	// per trial at Lights, the bandwidth needed to reach the target
+	TotalRequests float64 `json:"total_requests"`
+
+	// Duration is the total time spent on all probes of the size
+	Duration time.Duration `json:"duration"`
+
+	// Targets maps every target probability that was met to the smallest
+	// probed lights count meeting it
+	Targets TargetThresholds `json:"targets,omitempty"`
+}
+
+// TargetThresholds maps target probabilities to threshold lights counts
+type TargetThresholds map[float64]int
+
+// MarshalJSON encodes the thresholds as an object keyed by the target
+// probability, since JSON object keys must be strings
+func (t TargetThresholds) MarshalJSON() ([]byte, error) {
+	m := make(map[string]int, len(t))
+	for target, lights := range t {
+		m[strconv.FormatFloat(target, 'g', -1, 64)] = lights
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON decodes thresholds encoded by MarshalJSON
+func (t *TargetThresholds) UnmarshalJSON(data []byte) error {
+	var m map[string]int
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+
+	*t = make(TargetThresholds, len(m))
+	for key, lights := range m {
+		target, err := strconv.ParseFloat(key, 64)
+		if err != nil {
+			return err
+		}
+		(*t)[target] = lights
+	}
+	return nil
+}
+
+// Thresholds extracts the per-size thresholds from the results returned by
+// RunSimulation, one per model, size and repeat in the order they were simulated.
+// The threshold is the smallest probed lights count that reached the target,
+// or the smallest samples per node with SweepSamplesPerNode,
+// and Targets holds the same for every target of TargetProbabilities.
+// A size that never reached the target reports its last probed lights count
+// with Reached set to false.
+func Thresholds(results []SimulationResult) []ThresholdResult {
+	var (
+		thresholds []ThresholdResult
+		starts     []int
+	)
+	for i, r := range results {
+		n := len(thresholds)
+		if n == 0 || thresholds[n-1].Size != r.Size || thresholds[n-1].Repeat != r.Repeat || thresholds[n-1].Model != r.Model {
+			thresholds = append(thresholds, ThresholdResult{Model: r.Model, Repeat: r.Repeat, Size: r.Size})
+			starts = append(starts, i)
+			n++
+		}
+
+		t := &thresholds[n-1]
+		t.Duration += r.Duration
+		for _, target := range r.ReachedTargets {
+			if lights, ok := t.Targets[target]; !ok || r.Lights < lights {
+				if t.Targets == nil {
+					t.Targets = make(TargetThresholds)
+				}
+				t.Targets[target] = r.Lights
+			}
+		}
+		switch {
+		case r.Reached && (!t.Reached || r.Lights < t.Lights || r.Lights == t.Lights && r.SamplesPerIteration < t.SamplesPerIteration):
+			t.Lights, t.SamplesPerIteration = r.Lights, r.SamplesPerIteration
+			t.TotalRequests = r.RequestedSamples
+			t.Reached = true
+		case !t.Reached:
+			t.Lights, t.SamplesPerIteration = r.Lights, r.SamplesPerIteration
+			t.TotalRequests = r.RequestedSamples
+		}
+	}
+
+	starts = append(starts, len(results))
+	for i := range thresholds {
+		if thresholds[i].Reached {
+			thresholds[i].InterpolatedThreshold = interpolateThreshold(results[starts[i]:starts[i+1]], thresholds[i].Lights)
+		}
+	}
+	return thresholds
+}
+
+// interpolateThreshold estimates where the probability of the probes of a
+// single size crosses their target, given the smallest passing lights count
+func interpolateThreshold(probes []SimulationResult, lights int) float64 {
+	var pass, fail *SimulationResult
+	for i := range probes {
+		p := &probes[i]
+		switch {
+		case p.Lights == lights:
+			pass = p
+		case p.Lights < lights && (fail == nil || p.Lights > fail.Lights):
+			fail = p
+		}
+	}
+	if fail == nil || pass.Probability <= fail.Probability {
+		return float64(lights)
+	}
+
+	frac := (pass.Target - fail.Probability) / (pass.Probability - fail.Probability)
+	frac = min(max(frac, 0), 1)
+	return float64(fail.Lights) + frac*float64(pass.Lights-fail.Lights)
+}
+
+// AggregateResult summarizes the thresholds of a single model and size across
+// repeated sweeps
+type AggregateResult struct {
+	Model SamplingModel `json:"model"`
+	Size  int           `json:"size"`
+
+	// Repeats is the number of sweeps and Reached how many of them found a
+	// threshold. The statistics below only cover the reached thresholds.
+	Repeats int `json:"repeats"`
+	Reached int `json:"reached"`
+
+	MeanLights   float64 `json:"mean_lights"`
+	StdDevLights float64 `json:"stddev_lights"`
+	MinLights    int     `json:"min_lights"`
+	MaxLights    int     `json:"max_lights"`
+
+	// P5Lights, P50Lights and P95Lights are the nearest-rank percentiles of
+	// the thresholds, which show a skewed spread the mean hides
+	P5Lights  int `json:"p5_lights"`
+	P50Lights int `json:"p50_lights"`
+	P95Lights int `json:"p95_lights"`
+}
+
+// Aggregate computes per-size threshold statistics across the repeated
+// sweeps in results, ordered by the first appearance of each model and size
+func Aggregate(results []SimulationResult) []AggregateResult {
+	type key struct {
+		model SamplingModel
+		size  int
+	}
+	var (
+		keys   []key
+		lights = make(map[key][]int)
+		runs   = make(map[key]int)
+	)
+	for _, t := range Thresholds(results) {
+		k := key{t.Model, t.Size}
+		if _, ok := runs[k]; !ok {
+			keys = append(keys, k)
+		}
+		runs[k]++
+		if t.Reached {
+			lights[k] = append(lights[k], t.Lights)
+		}
+	}
+
+	aggregates := make([]AggregateResult, 0, len(keys))
+	for _, k := range keys {
+		a := AggregateResult{Model: k.model, Size: k.size, Repeats: runs[k], Reached: len(lights[k])}
+		if a.Reached > 0 {
+			sorted := lights[k]
+			slices.Sort(sorted)
+			a.MinLights, a.MaxLights = sorted[0], sorted[len(sorted)-1]
+			a.MeanLights, a.StdDevLights = meanStdDev(sorted)
+			a.P5Lights = percentile(sorted, 0.05)
+			a.P50Lights = percentile(sorted, 0.5)
+			a.P95Lights = percentile(sorted, 0.95)
+		}
+		aggregates = append(aggregates, a)
+	}
+	return aggregates
+}
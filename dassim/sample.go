@@ -0,0 +1,110 @@
+package dassim
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand"
+	"slices"
+)
+
+// Sample represents a single point in the data square
+type Sample struct {
+	Row, Col int
+}
+
+// SampleSet maintains a collection of unique samples
+type SampleSet struct {
+	samples map[Sample]bool
+}
+
+// NewSampleSet creates a new initialized SampleSet
+func NewSampleSet(capacity int) *SampleSet {
+	return &SampleSet{
+		samples: make(map[Sample]bool, capacity),
+	}
+}
+
+// Clear removes all samples from the set
+func (s *SampleSet) Clear() {
+	clear(s.samples)
+}
+
+// FillUnique adds n unique random samples within the given size bounds,
+// drawing cells from dist
+func (s *SampleSet) FillUnique(n, size int, rng *rand.Rand, dist Distribution) {
+	for n > 0 {
+		row, col := dist.Sample(rng, size)
+		sample := Sample{Row: row, Col: col}
+
+		if !s.samples[sample] {
+			s.samples[sample] = true
+			n--
+		}
+	}
+}
+
+// FillRandom draws n random samples within the given size bounds from dist
+// with replacement, so repeated draws of a cell collapse and the set grows
+// by at most n
+func (s *SampleSet) FillRandom(n, size int, rng *rand.Rand, dist Distribution) {
+	for ; n > 0; n-- {
+		row, col := dist.Sample(rng, size)
+		s.samples[Sample{Row: row, Col: col}] = true
+	}
+}
+
+// SamplingModel selects how the samples of individual light nodes relate
+type SamplingModel int
+
+const (
+	// PerNode has every light node draw its samples independently, unique
+	// within the node but possibly colliding with other nodes' samples
+	PerNode SamplingModel = iota
+
+	// SharedUnique draws all samples of all light nodes from a single pool,
+	// so no two nodes ever sample the same cell
+	SharedUnique
+)
+
+// String returns the name used for the model on the command line
+func (m SamplingModel) String() string {
+	switch m {
+	case PerNode:
+		return "per-node"
+	case SharedUnique:
+		return "shared-unique"
+	default:
+		return fmt.Sprintf("SamplingModel(%d)", int(m))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (m SamplingModel) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (m *SamplingModel) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "per-node":
+		*m = PerNode
+	case "shared-unique":
+		*m = SharedUnique
+	default:
+		return fmt.Errorf("unknown sampling model %q", text)
+	}
+	return nil
+}
+
+// Sorted returns the samples in the set ordered by row, then column
+func (s *SampleSet) Sorted() []Sample {
+	sorted := make([]Sample, 0, len(s.samples))
+	for sample := range s.samples {
+		sorted = append(sorted, sample)
+	}
+
+	slices.SortFunc(sorted, func(a, b Sample) int {
+		return cmp.Or(cmp.Compare(a.Row, b.Row), cmp.Compare(a.Col, b.Col))
+	})
+	return sorted
+}
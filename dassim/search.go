@@ -0,0 +1,158 @@
+package dassim
+
+import "fmt"
+
+// SearchStrategy selects how RunSimulation looks for the smallest lights
+// count that reaches the target probability
+type SearchStrategy int
+
+const (
+	// LinearSearch increments lights by size/SizeIterFactor until the target is reached
+	LinearSearch SearchStrategy = iota
+
+	// BinarySearch doubles lights until the target is reached, then bisects
+	// between the last failing and the first passing count
+	BinarySearch
+)
+
+// String returns the name used for the strategy on the command line
+func (s SearchStrategy) String() string {
+	switch s {
+	case LinearSearch:
+		return "linear"
+	case BinarySearch:
+		return "binary"
+	default:
+		return fmt.Sprintf("SearchStrategy(%d)", int(s))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s SearchStrategy) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (s *SearchStrategy) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "linear":
+		*s = LinearSearch
+	case "binary":
+		*s = BinarySearch
+	default:
+		return fmt.Errorf("unknown search strategy %q", text)
+	}
+	return nil
+}
+
+// searchLinear probes lights from initial upwards in steps of step and
+// returns the first count for which probe reports the target was reached.
+// It gives up once lights would exceed maxLights, returning the last probed
+// count with reached set to false.
+func searchLinear(initial, step, maxLights int, probe func(lights int) (bool, error)) (lights int, reached bool, err error) {
+	for next := initial; next <= maxLights; next += step {
+		lights = next
+		if reached, err = probe(lights); err != nil || reached {
+			return lights, reached, err
+		}
+	}
+	return lights, false, nil
+}
+
+// searchBinary doubles lights from initial until probe reports the target
+// was reached, then bisects down to the smallest passing count. Counts below
+// initial are not probed, matching searchLinear. Doubling stops at
+// maxLights, and if that fails too the search gives up with reached set to
+// false.
+func searchBinary(initial, maxLights int, probe func(lights int) (bool, error)) (lights int, reached bool, err error) {
+	if initial > maxLights {
+		return initial, false, nil
+	}
+
+	fail, pass := initial-1, initial
+	for {
+		if reached, err = probe(pass); err != nil {
+			return pass, false, err
+		}
+		if reached {
+			break
+		}
+		if pass >= maxLights {
+			return pass, false, nil
+		}
+		fail, pass = pass, min(max(pass*2, pass+1), maxLights)
+	}
+
+	lights, err = bisect(fail, pass, probe)
+	return lights, true, err
+}
+
+// searchBelow bisects down to the smallest passing count below initial,
+// which probe already reported as passing, taking a count of 0 to fail. It
+// lets a OneD search whose first probe passes report a threshold rather
+// than its starting point.
+func searchBelow(initial int, probe func(lights int) (bool, error)) (lights int, err error) {
+	return bisect(0, initial, probe)
+}
+
+// bisect narrows the failing count fail and the passing count pass down to
+// adjacent counts and returns the passing one
+func bisect(fail, pass int, probe func(lights int) (bool, error)) (int, error) {
+	for pass-fail > 1 {
+		mid := fail + (pass-fail)/2
+		reached, err := probe(mid)
+		if err != nil {
+			return pass, err
+		}
+		if reached {
+			pass = mid
+		} else {
+			fail = mid
+		}
+	}
+	return pass, nil
+}
+
+// SweepVariable selects which quantity RunSimulation searches per size
+type SweepVariable int
+
+const (
+	// SweepLights searches the smallest lights count at SamplesPerIteration
+	// samples per node
+	SweepLights SweepVariable = iota
+
+	// SweepSamplesPerNode holds lights at the initial lights count of each
+	// size and searches the smallest SamplesPerIteration, starting from the
+	// configured value in steps of 1
+	SweepSamplesPerNode
+)
+
+// String returns the name used for the sweep variable on the command line
+func (v SweepVariable) String() string {
+	switch v {
+	case SweepLights:
+		return "lights"
+	case SweepSamplesPerNode:
+		return "samples-per-node"
+	default:
+		return fmt.Sprintf("SweepVariable(%d)", int(v))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (v SweepVariable) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (v *SweepVariable) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "lights":
+		*v = SweepLights
+	case "samples-per-node":
+		*v = SweepSamplesPerNode
+	default:
+		return fmt.Errorf("unknown sweep variable %q", text)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package dassim
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLinearSearchAdvancesAtSmallSize(t *testing.T) {
+	config := NewDefaultConfig()
+	config.SizeIterFactor = 64
+	step := config.lightsStep(16)
+	if step != 1 {
+		t.Fatalf("lightsStep(16) with factor 64 is %d, want 1", step)
+	}
+
+	var probed []int
+	lights, reached, err := searchLinear(10, step, 20, func(lights int) (bool, error) {
+		probed = append(probed, lights)
+		return lights >= 13, nil
+	})
+	if err != nil || !reached || lights != 13 {
+		t.Fatalf("searchLinear returned %d, %v, %v, want 13, true, nil", lights, reached, err)
+	}
+	if want := []int{10, 11, 12, 13}; !slices.Equal(probed, want) {
+		t.Fatalf("probed %v, want %v", probed, want)
+	}
+}
+
+func TestSearchBelowFindsThresholdUnderPassingStart(t *testing.T) {
+	lights, err := searchBelow(20, func(lights int) (bool, error) {
+		if lights < 1 {
+			t.Fatalf("probed %d lights", lights)
+		}
+		return lights >= 7, nil
+	})
+	if err != nil || lights != 7 {
+		t.Fatalf("searchBelow returned %d, %v, want 7, nil", lights, err)
+	}
+}
+
+func TestTwoDSearchStartsAtInitialLights(t *testing.T) {
+	config := NewDefaultConfig()
+	config.MaxSize = 16
+	config.LightsAt16 = 100
+	config.Iterations = 20
+	config.Verbose = false
+	results, err := RunSimulation(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Lights != 100 {
+		t.Fatalf("got %+v, want a single probe at the initial 100 lights", results)
+	}
+}
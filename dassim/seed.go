@@ -0,0 +1,20 @@
+package dassim
+
+// deriveSeed mixes base with parts into a new seed, so that seeds derived
+// from different parts are unrelated even when the parts differ by one
+func deriveSeed(base int64, parts ...int64) int64 {
+	x := uint64(base)
+	for _, p := range parts {
+		x = splitmix64(x ^ splitmix64(uint64(p)))
+	}
+	return int64(x)
+}
+
+// splitmix64 is the finalizer of the SplitMix64 generator, a fast bijective
+// hash with good avalanche behavior
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
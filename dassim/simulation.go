@@ -0,0 +1,402 @@
+package dassim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrThresholdNotReached is wrapped by the error of RunSimulation when a
+// size never reached the target probability within its search range
+var ErrThresholdNotReached = errors.New("threshold not reached")
+
+// RunSimulation executes the main simulation with the given configuration
+// and returns the result of every probed lights count in the order they ran.
+// It returns the error of Validate without running anything when the config
+// is invalid. When any size fails to reach the target, all sizes are still
+// simulated and their results returned with an error wrapping
+// ErrThresholdNotReached.
+func RunSimulation(config *SimulationConfig) ([]SimulationResult, error) {
+	return RunSimulationContext(context.Background(), config)
+}
+
+// RunSimulationContext is like RunSimulation but stops once ctx is done,
+// returning the results gathered so far together with ctx.Err()
+func RunSimulationContext(ctx context.Context, config *SimulationConfig) ([]SimulationResult, error) {
+	return simulate(ctx, config, nil, nil)
+}
+
+// SimulationStream is a simulation running in the background
+type SimulationStream struct {
+	// Results receives every result as soon as its lights count completes.
+	// It is closed when the simulation finishes or its context is done.
+	Results <-chan SimulationResult
+
+	err error
+}
+
+// Err returns the error the simulation ended with, which wraps
+// ErrThresholdNotReached when some size did not reach the target or is the
+// context error when it was cancelled. It is only valid once Results is
+// closed.
+func (s *SimulationStream) Err() error {
+	return s.err
+}
+
+// RunSimulationStream runs the simulation in a new goroutine and sends every
+// result on the Results channel of the returned stream. The channel is
+// unbuffered, so a slow consumer holds back the simulation rather than
+// losing results. An invalid config returns the error of Validate and no
+// stream.
+func RunSimulationStream(ctx context.Context, config *SimulationConfig) (*SimulationStream, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan SimulationResult)
+	stream := &SimulationStream{Results: ch}
+	go func() {
+		defer close(ch)
+		_, stream.err = simulate(ctx, config, func(result SimulationResult) error {
+			select {
+			case ch <- result:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}, nil)
+	}()
+	return stream, nil
+}
+
+// simulate runs all configured sweeps, passing every result to emit as soon
+// as it is available when emit is non-nil, and returns all results in order.
+// Probes found in completed are taken from it instead of being run again and
+// are not emitted.
+func simulate(ctx context.Context, config *SimulationConfig, emit func(SimulationResult) error, completed []SimulationResult) (results []SimulationResult, err error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	for _, target := range config.targets() {
+		config.logf("Starting simulation with target probability: %.2f%%\n", target*100)
+	}
+
+	seed := config.resolveSeed()
+	if config.CheckpointPath != "" {
+		cp := newCheckpointer(config, seed, completed)
+		defer func() {
+			// keep the progress of an interrupted run
+			if cpErr := cp.write(); err == nil {
+				err = cpErr
+			}
+		}()
+
+		next := emit
+		emit = func(result SimulationResult) error {
+			if err := cp.record(result); err != nil {
+				return err
+			}
+			if next != nil {
+				return next(result)
+			}
+			return nil
+		}
+	}
+
+	var done map[probeKey]SimulationResult
+	if len(completed) > 0 {
+		done = make(map[probeKey]SimulationResult, len(completed))
+		for _, r := range completed {
+			done[probeKey{r.Model, r.Repeat, r.Size, r.Lights, r.SamplesPerIteration}] = r
+		}
+	}
+
+	repeats := max(config.Repeats, 1)
+	for _, model := range config.models() {
+		modelConfig := config
+		if len(config.CompareModels) > 0 {
+			c := *config
+			c.SamplingModel = model
+			modelConfig = &c
+			config.logf("\nStarting model %s\n", model)
+		}
+
+		for repeat := 0; repeat < repeats; repeat++ {
+			repeatSeed := seed
+			if repeat > 0 {
+				repeatSeed = deriveSeed(seed, int64(repeat))
+				config.logf("\nStarting repeat %d/%d with seed: %d\n", repeat+1, repeats, repeatSeed)
+			}
+
+			sweep, err := runSweep(ctx, modelConfig, repeat, repeatSeed, emit, done)
+			results = append(results, sweep...)
+			if err != nil {
+				return results, err
+			}
+		}
+	}
+
+	if repeats > 1 {
+		config.logf("\nThreshold statistics over %d repeats:\n", repeats)
+		for _, a := range Aggregate(results) {
+			config.logf("%sSize: %d, Mean: %.2f, StdDev: %.2f, Min: %d, Max: %d, P5: %d, P50: %d, P95: %d (%d/%d reached)\n",
+				config.modelPrefix(a.Model), a.Size, a.MeanLights, a.StdDevLights, a.MinLights, a.MaxLights,
+				a.P5Lights, a.P50Lights, a.P95Lights, a.Reached, a.Repeats)
+		}
+	} else if len(config.CompareModels) > 0 {
+		config.logf("\nThresholds by model:\n")
+		for _, t := range Thresholds(results) {
+			config.logf("Model: %s, Size: %d, Lights: %d (reached: %v)\n", t.Model, t.Size, t.Lights, t.Reached)
+		}
+	}
+	return results, config.thresholdError(results)
+}
+
+// thresholdError returns an error wrapping ErrThresholdNotReached that lists
+// every configured model, repeat and size that never reached the target,
+// including any that have no results at all, or nil
+func (c *SimulationConfig) thresholdError(results []SimulationResult) error {
+	type sweep struct {
+		model        SamplingModel
+		repeat, size int
+	}
+	reached := make(map[sweep]bool)
+	for _, t := range Thresholds(results) {
+		reached[sweep{t.Model, t.Repeat, t.Size}] = t.Reached
+	}
+
+	var failed []string
+	for _, model := range c.models() {
+		for repeat := 0; repeat < max(c.Repeats, 1); repeat++ {
+			for _, size := range c.sizes() {
+				if reached[sweep{model, repeat, size}] {
+					continue
+				}
+				desc := fmt.Sprintf("size %d", size)
+				if c.Repeats > 1 {
+					desc += fmt.Sprintf(" in repeat %d", repeat)
+				}
+				if len(c.CompareModels) > 0 {
+					desc += fmt.Sprintf(" with model %s", model)
+				}
+				failed = append(failed, desc)
+			}
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w for %s", ErrThresholdNotReached, strings.Join(failed, ", "))
+}
+
+// runSweep runs a single sweep over all sizes, sampling every trial from
+// seed. With ParallelSizes above 1 that many sizes run concurrently, and the
+// results are still returned in size order.
+func runSweep(ctx context.Context, config *SimulationConfig, repeat int, seed int64, emit func(SimulationResult) error, done map[probeKey]SimulationResult) ([]SimulationResult, error) {
+	sizes := config.sizes()
+	if config.ParallelSizes <= 1 {
+		var results []SimulationResult
+		for _, size := range sizes {
+			sizeResults, err := runSize(ctx, config, repeat, seed, size, emit, done)
+			results = append(results, sizeResults...)
+			if err != nil {
+				return results, err
+			}
+		}
+		return results, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		perSize = make([][]SimulationResult, len(sizes))
+		errs    = make([]error, len(sizes))
+		sem     = make(chan struct{}, config.ParallelSizes)
+		wg      sync.WaitGroup
+	)
+	for i, size := range sizes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			perSize[i], errs[i] = runSize(ctx, config, repeat, seed, size, emit, done)
+			if errs[i] != nil {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var results []SimulationResult
+	for i := range sizes {
+		results = append(results, perSize[i]...)
+		if errs[i] != nil {
+			return results, errs[i]
+		}
+	}
+	return results, nil
+}
+
+// runSize searches for the threshold lights count of a single size and
+// returns the result of every probe, taking those found in done from it
+func runSize(ctx context.Context, config *SimulationConfig, repeat int, seed int64, size int, emit func(SimulationResult) error, done map[probeKey]SimulationResult) ([]SimulationResult, error) {
+	var results []SimulationResult
+	config.logf("\nProcessing size: %d x %d\n", size*2, size*2)
+	if config.OnSizeStart != nil {
+		config.OnSizeStart(size)
+	}
+
+	sizeStart := time.Now()
+	initialLights := config.InitialLightsFor(size)
+	config.logf("Initial lights: %d\n", initialLights)
+
+	// probeAt runs the trials of lights nodes taking samples each
+	probeAt := func(lights, samples int) (bool, error) {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+
+		probeConfig := config
+		if samples != config.SamplesPerIteration {
+			c := *config
+			c.SamplesPerIteration = samples
+			probeConfig = &c
+		}
+
+		result, ok := done[probeKey{config.SamplingModel, repeat, size, lights, samples}]
+		if !ok {
+			start := time.Now()
+			stats, err := runProbe(ctx, probeConfig, size, lights, seed)
+			if err != nil {
+				return false, err
+			}
+
+			result = probeConfig.newResult(size, lights, stats, seed)
+			result.Repeat = repeat
+			result.Duration = time.Since(start)
+		}
+		results = append(results, result)
+		// replayed probes were already emitted before the checkpoint
+		if emit != nil && !ok {
+			if err := emit(result); err != nil {
+				return false, err
+			}
+		}
+		if config.OnProbe != nil {
+			config.OnProbe(size, lights, result.SuccessCount, result.Iterations)
+		}
+
+		var prefix string
+		if config.SweepVariable == SweepSamplesPerNode {
+			prefix = fmt.Sprintf("Samples per node: %d, ", samples)
+		}
+		config.logf("%sLights: %d, Success Rate: %.2f%% [%.2f%%, %.2f%%] (%d/%d)\n",
+			prefix,
+			lights,
+			result.Probability*100,
+			result.LowerBound*100,
+			result.UpperBound*100,
+			result.SuccessCount,
+			result.Iterations)
+		return result.Reached, nil
+	}
+
+	var (
+		value, initial, step, limit int
+		reached                     bool
+		err                         error
+		probe                       func(int) (bool, error)
+		unit                        string
+	)
+	switch config.SweepVariable {
+	case SweepSamplesPerNode:
+		initial, step, limit, unit = config.SamplesPerIteration, 1, config.sampleableCells(size), "samples per node"
+		probe = func(samples int) (bool, error) { return probeAt(initialLights, samples) }
+	default:
+		initial, step, limit, unit = initialLights, config.lightsStep(size), config.maxLights(size), "lights"
+		probe = func(lights int) (bool, error) { return probeAt(lights, config.SamplesPerIteration) }
+	}
+	switch config.SearchStrategy {
+	case BinarySearch:
+		value, reached, err = searchBinary(initial, limit, probe)
+	default:
+		value, reached, err = searchLinear(initial, step, limit, probe)
+	}
+	if err == nil && reached && value == initial && initial > 1 && config.Dimension == OneD {
+		// a OneD vector may already recover at the lights count scaled for
+		// 2D, so look for its threshold below the start
+		config.logf("First probe already reached the target, searching below %d %s\n", initial, unit)
+		value, err = searchBelow(initial, probe)
+	}
+	if err != nil {
+		return results, err
+	}
+
+	if !reached {
+		config.logf("WARNING: threshold not found for size %d, target probability not reached within %d %s\n", size, limit, unit)
+		return results, nil
+	}
+	if config.SweepVariable == SweepSamplesPerNode {
+		config.logf("Target probability reached for size %d with %d samples per node at %d lights in %s\n",
+			size, value, initialLights, time.Since(sizeStart).Round(time.Millisecond))
+		return results, nil
+	}
+
+	threshold := Thresholds(results)[0]
+	if len(config.TargetProbabilities) > 1 {
+		for _, target := range config.TargetProbabilities {
+			config.logf("Target probability %.2f%% reached for size %d with %d lights\n", target*100, size, threshold.Targets[target])
+		}
+	}
+	config.logf("Target probability reached for size %d with %d lights (interpolated %.2f, %.0f requests) in %s\n",
+		size, value, threshold.InterpolatedThreshold, threshold.TotalRequests, time.Since(sizeStart).Round(time.Millisecond))
+	return results, nil
+}
+
+// RunWithholdingSweep measures how the success probability at a fixed size
+// and lights count degrades as the block producer withholds each of the
+// given fractions of the extended square. All other options are taken from
+// config, whose sizes and WithheldFraction are ignored. It returns an error
+// when the config is invalid for size or a fraction is outside [0,1).
+func RunWithholdingSweep(config *SimulationConfig, size, lights int, fractions []float64) ([]SimulationResult, error) {
+	if lights <= 0 {
+		return nil, fmt.Errorf("lights must be positive, got %d", lights)
+	}
+	sweep := *config
+	sweep.Sizes = []int{size}
+	for _, fraction := range fractions {
+		sweep.WithheldFraction = fraction
+		if err := sweep.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	seed := config.resolveSeed()
+	results := make([]SimulationResult, 0, len(fractions))
+	for _, fraction := range fractions {
+		sweep.WithheldFraction = fraction
+		stats, err := runProbe(context.Background(), &sweep, size, lights, seed)
+		if err != nil {
+			return results, err
+		}
+		result := sweep.newResult(size, lights, stats, seed)
+		results = append(results, result)
+
+		config.logf("Withheld: %.2f%%, Success Rate: %.2f%% [%.2f%%, %.2f%%] (%d/%d)\n",
+			fraction*100,
+			result.Probability*100,
+			result.LowerBound*100,
+			result.UpperBound*100,
+			result.SuccessCount,
+			result.Iterations)
+	}
+	return results, nil
+}
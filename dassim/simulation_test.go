@@ -0,0 +1,90 @@
+package dassim
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParallelMatchesSequential(t *testing.T) {
+	run := func(parallel bool) []SimulationResult {
+		config := NewDefaultConfig()
+		config.MaxSize = 32
+		config.Iterations = 100
+		config.Seed = 5
+		config.Verbose = false
+		config.Parallel = parallel
+
+		results, err := RunSimulation(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range results {
+			results[i].Duration = 0
+		}
+		return results
+	}
+
+	sequential, parallel := run(false), run(true)
+	if !reflect.DeepEqual(sequential, parallel) {
+		t.Fatalf("parallel results differ from sequential ones:\n%+v\n%+v", parallel, sequential)
+	}
+}
+
+func TestRunSimulationStreamRejectsInvalidConfig(t *testing.T) {
+	config := NewDefaultConfig()
+	config.Iterations = 0
+	if _, err := RunSimulationStream(context.Background(), config); err == nil {
+		t.Fatal("RunSimulationStream accepted a config with 0 iterations")
+	}
+}
+
+func TestRunSimulationStreamReportsTerminalError(t *testing.T) {
+	config := NewDefaultConfig()
+	config.MaxSize = 16
+	config.Iterations = 20
+	config.MaxLights = 12
+	config.Verbose = false
+	stream, err := RunSimulationStream(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var results int
+	for range stream.Results {
+		results++
+	}
+	if results == 0 || !errors.Is(stream.Err(), ErrThresholdNotReached) {
+		t.Fatalf("stream sent %d results and ended with %v, want results and ErrThresholdNotReached", results, stream.Err())
+	}
+}
+
+func TestThresholdErrorListsSizesWithoutResults(t *testing.T) {
+	config := NewDefaultConfig()
+	config.MaxSize = 64
+	err := config.thresholdError([]SimulationResult{
+		{Size: 16, Lights: 30, Reached: true},
+		{Size: 32, Lights: 100},
+	})
+	if !errors.Is(err, ErrThresholdNotReached) || err.Error() != "threshold not reached for size 32, size 64" {
+		t.Fatalf("thresholdError returned %v, want sizes 32 and 64 listed", err)
+	}
+}
+
+func TestRunWithholdingSweepRejectsInvalidFractions(t *testing.T) {
+	config := NewDefaultConfig()
+	config.Iterations = 10
+	config.Verbose = false
+	if _, err := RunWithholdingSweep(config, 16, 30, []float64{0, 1.5}); err == nil {
+		t.Fatal("RunWithholdingSweep accepted a withheld fraction above 1")
+	}
+	if _, err := RunWithholdingSweep(config, 10, 30, []float64{0}); err == nil {
+		t.Fatal("RunWithholdingSweep accepted a size that is not a power of two")
+	}
+
+	results, err := RunWithholdingSweep(config, 16, 30, []float64{0, 0.5})
+	if err != nil || len(results) != 2 {
+		t.Fatalf("RunWithholdingSweep returned %d results and %v, want 2 results", len(results), err)
+	}
+}
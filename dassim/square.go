@@ -0,0 +1,475 @@
+package dassim
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// DataSquare represents the main data structure for the recovery simulation
+// Despite the name it may also hold a rectangular region, see NewDataRect
+type DataSquare struct {
+	// Size is the width k of the original data of a square region
+	// It is 0 for rectangular regions
+	Size int
+
+	// RowLen is the number of cells in each row and ColLen the number of
+	// cells in each column of the extended region
+	RowLen int
+	ColLen int
+
+	// cells holds one bit per cell of the extended region, set once the
+	// cell is sampled or recovered
+	cells bitset
+
+	// sampled holds one bit per cell that was placed by AddSample rather
+	// than reconstructed during recovery
+	sampled bitset
+
+	RowCounts     []int
+	ColCounts     []int
+	RecoveredRows map[int]bool
+	RecoveredCols map[int]bool
+	TotalCount    int
+
+	// Withheld holds the cells the block producer refuses to serve
+	// Samples of these cells are never recorded, but recovery can still
+	// reconstruct them
+	Withheld map[Sample]bool
+
+	// RowThreshold is the number of samples a row needs to be recovered and
+	// ColThreshold the number a column needs
+	RowThreshold int
+	ColThreshold int
+
+	// AlwaysPropagate makes Recover run the propagation loop even when
+	// Recoverable reports that full recovery is impossible, which lets
+	// partial recovery be measured below the sample count threshold
+	AlwaysPropagate bool
+
+	// Incremental makes AddSample recover the row and column of every new
+	// sample right away, propagating to every line that becomes recoverable,
+	// so IsRecovered is up to date after each insertion without calling
+	// Recover. The cells end up as a full Recover with AlwaysPropagate
+	// would leave them.
+	Incremental bool
+
+	// RecordSamples makes AddSample append every placed sample to the log
+	// returned by SampleLog, so the exact order of a trial can be replayed
+	RecordSamples bool
+
+	// sampleLog holds the samples placed since the last Reset while
+	// RecordSamples is set, reusing its backing array across trials
+	sampleLog []Sample
+
+	// wave and nextWave are scratch space of RecoverWithStats
+	wave, nextWave []line
+}
+
+// line identifies a row, or a column when col is set
+type line struct {
+	index int
+	col   bool
+}
+
+// NewDataSquare creates a new initialized DataSquare
+func NewDataSquare(size int) *DataSquare {
+	ds := NewDataRect(size, size)
+	ds.Size = size
+	return ds
+}
+
+// NewDataRect creates a new initialized region whose original data has the
+// given number of rows and columns, extended to 2*rows x 2*cols
+func NewDataRect(rows, cols int) *DataSquare {
+	ds := newRegion(2*cols, 2*rows)
+	ds.RowThreshold = cols
+	ds.ColThreshold = rows
+	return ds
+}
+
+// newRegion creates an empty region of colLen rows of rowLen cells without
+// recovery thresholds
+func newRegion(rowLen, colLen int) *DataSquare {
+	return &DataSquare{
+		RowLen:        rowLen,
+		ColLen:        colLen,
+		cells:         newBitset(rowLen * colLen),
+		sampled:       newBitset(rowLen * colLen),
+		RowCounts:     make([]int, colLen),
+		ColCounts:     make([]int, rowLen),
+		RecoveredRows: make(map[int]bool),
+		RecoveredCols: make(map[int]bool),
+		Withheld:      make(map[Sample]bool),
+	}
+}
+
+// Clone returns a deep copy of the region, so mutating either copy leaves
+// the other unchanged
+func (ds *DataSquare) Clone() *DataSquare {
+	clone := *ds
+	clone.cells = slices.Clone(ds.cells)
+	clone.sampled = slices.Clone(ds.sampled)
+	clone.RowCounts = slices.Clone(ds.RowCounts)
+	clone.ColCounts = slices.Clone(ds.ColCounts)
+	clone.RecoveredRows = maps.Clone(ds.RecoveredRows)
+	clone.RecoveredCols = maps.Clone(ds.RecoveredCols)
+	clone.Withheld = maps.Clone(ds.Withheld)
+	clone.sampleLog = slices.Clone(ds.sampleLog)
+	clone.wave, clone.nextWave = nil, nil
+	return &clone
+}
+
+// SetRecoveryThreshold changes the number of samples both rows and columns
+// need to be recovered, which must be between 1 and the shorter of RowLen
+// and ColLen
+func (ds *DataSquare) SetRecoveryThreshold(threshold int) error {
+	limit := min(ds.RowLen, ds.ColLen)
+	if threshold < 1 || threshold > limit {
+		return fmt.Errorf("recovery threshold must be between 1 and %d, got %d", limit, threshold)
+	}
+	ds.RowThreshold = threshold
+	ds.ColThreshold = threshold
+	return nil
+}
+
+// Reset clears all data in the DataSquare, reusing the count slices unless
+// the dimensions changed
+func (ds *DataSquare) Reset() {
+	ds.RowCounts = resetCounts(ds.RowCounts, ds.ColLen)
+	ds.ColCounts = resetCounts(ds.ColCounts, ds.RowLen)
+	clear(ds.RecoveredRows)
+	clear(ds.RecoveredCols)
+	clear(ds.Withheld)
+	ds.TotalCount = 0
+	ds.cells.reset()
+	ds.sampled.reset()
+	ds.sampleLog = ds.sampleLog[:0]
+}
+
+// resetCounts returns counts zeroed in place, or a new slice of n zeros
+// when counts has a different length
+func resetCounts(counts []int, n int) []int {
+	if len(counts) != n {
+		return make([]int, n)
+	}
+	clear(counts)
+	return counts
+}
+
+// Get reports whether the cell at row, col is sampled or recovered
+func (ds *DataSquare) Get(row, col int) bool {
+	return ds.cells.get(row*ds.RowLen + col)
+}
+
+// Set marks the cell at row, col as present without updating any counts
+// Use AddSample to record a sample
+func (ds *DataSquare) Set(row, col int) {
+	ds.cells.set(row*ds.RowLen + col)
+}
+
+// Withhold marks all cells in the given set as unavailable for sampling
+// The withheld set is cleared by Reset
+func (ds *DataSquare) Withhold(cells *SampleSet) {
+	for s := range cells.samples {
+		ds.Withheld[s] = true
+	}
+}
+
+// AddSamples adds all samples from the given set to the DataSquare,
+// skipping any withheld cells, and returns how many were new
+func (ds *DataSquare) AddSamples(samples *SampleSet) int {
+	added := 0
+	for s := range samples.samples {
+		if ds.addSampled(s) {
+			added++
+		}
+	}
+	return added
+}
+
+// addSampled records a sample taken by a light node unless its cell is
+// withheld, reporting whether the sample was new
+func (ds *DataSquare) addSampled(s Sample) bool {
+	return !ds.Withheld[s] && ds.AddSample(s.Row, s.Col)
+}
+
+// AddSample adds a single sample to the DataSquare, reporting false if the
+// cell was already present
+func (ds *DataSquare) AddSample(row, col int) bool {
+	if !ds.fill(row, col) {
+		return false
+	}
+
+	ds.sampled.set(row*ds.RowLen + col)
+	if ds.RecordSamples {
+		ds.sampleLog = append(ds.sampleLog, Sample{Row: row, Col: col})
+	}
+	if ds.Incremental {
+		ds.TryRecoverRow(row)
+		ds.TryRecoverCol(col)
+	}
+	return true
+}
+
+// fill marks the cell at row, col as present and updates the counts,
+// reporting false if it already was
+func (ds *DataSquare) fill(row, col int) bool {
+	if ds.Get(row, col) {
+		return false
+	}
+
+	ds.Set(row, col)
+	ds.RowCounts[row]++
+	ds.ColCounts[col]++
+	ds.TotalCount++
+	return true
+}
+
+// TryRecoverRow attempts to recover a row if it meets the criteria
+func (ds *DataSquare) TryRecoverRow(row int) bool {
+	if ds.RecoveredRows[row] {
+		return false
+	}
+
+	if ds.RowCounts[row] >= ds.RowThreshold {
+		ds.RecoveredRows[row] = true
+		for col := 0; col < ds.RowLen; col++ {
+			if ds.fill(row, col) {
+				ds.TryRecoverCol(col)
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// TryRecoverCol attempts to recover a column if it meets the criteria
+func (ds *DataSquare) TryRecoverCol(col int) bool {
+	if ds.RecoveredCols[col] {
+		return false
+	}
+
+	if ds.ColCounts[col] >= ds.ColThreshold {
+		ds.RecoveredCols[col] = true
+		for row := 0; row < ds.ColLen; row++ {
+			if ds.fill(row, col) {
+				ds.TryRecoverRow(row)
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// IsRecovered checks if the DataSquare is fully recovered, which is the case
+// once enough rows are recovered to recover every column or vice versa
+func (ds *DataSquare) IsRecovered() bool {
+	return len(ds.RecoveredRows) >= ds.ColThreshold || len(ds.RecoveredCols) >= ds.RowThreshold
+}
+
+// RecoveredCells returns the number of cells that are sampled or recovered
+func (ds *DataSquare) RecoveredCells() int {
+	return ds.TotalCount
+}
+
+// RecoveredFraction returns the fraction of the extended square that is
+// sampled or recovered, which shows how close a failed trial came to recovery
+func (ds *DataSquare) RecoveredFraction() float64 {
+	return float64(ds.TotalCount) / float64(ds.RowLen*ds.ColLen)
+}
+
+// CountHistogram returns, for every possible count from 0 up to the row or
+// column length, how many rows and how many columns hold exactly that many
+// present cells
+func (ds *DataSquare) CountHistogram() (rowHist, colHist map[int]int) {
+	return countHistogram(ds.RowCounts, ds.RowLen), countHistogram(ds.ColCounts, ds.ColLen)
+}
+
+// countHistogram tallies counts into a histogram with a key for every value
+// from 0 to maxCount
+func countHistogram(counts []int, maxCount int) map[int]int {
+	hist := make(map[int]int, maxCount+1)
+	for n := 0; n <= maxCount; n++ {
+		hist[n] = 0
+	}
+	for _, n := range counts {
+		hist[n]++
+	}
+	return hist
+}
+
+// SampledCells returns the number of cells placed by AddSample, so the
+// remaining RecoveredCells were reconstructed during recovery
+func (ds *DataSquare) SampledCells() int {
+	return ds.sampled.count()
+}
+
+// SampleLog returns the samples placed by AddSample since the last Reset in
+// the order they were placed, empty unless RecordSamples is set. Withheld,
+// duplicate and recovered cells are not included. The slice is reused by the
+// next Reset, so copy it to keep it.
+func (ds *DataSquare) SampleLog() []Sample {
+	return ds.sampleLog
+}
+
+// CellState describes where the content of a cell came from
+type CellState uint8
+
+const (
+	CellMissing   CellState = iota // neither sampled nor recovered
+	CellWithheld                   // missing and withheld by the block producer
+	CellSampled                    // placed by AddSample
+	CellRecovered                  // reconstructed by row or column recovery
+)
+
+// Provenance returns the state of the cell at row, col
+func (ds *DataSquare) Provenance(row, col int) CellState {
+	switch {
+	case ds.sampled.get(row*ds.RowLen + col):
+		return CellSampled
+	case ds.Get(row, col):
+		return CellRecovered
+	case ds.Withheld[Sample{Row: row, Col: col}]:
+		return CellWithheld
+	default:
+		return CellMissing
+	}
+}
+
+// Recoverable checks the necessary condition for full recovery, that at
+// least RowThreshold*ColThreshold cells are present, and explains why
+// recovery is impossible when it is not met. Passing the check does not
+// guarantee that Recover succeeds.
+func (ds *DataSquare) Recoverable() (possible bool, reason string) {
+	if need := ds.RowThreshold * ds.ColThreshold; ds.TotalCount < need {
+		return false, fmt.Sprintf("not enough samples: %d present, at least %d needed", ds.TotalCount, need)
+	}
+	return true, ""
+}
+
+// Recover attempts to recover the entire DataSquare
+func (ds *DataSquare) Recover() bool {
+	return ds.RecoverWithStats().Recovered
+}
+
+// RecoveryStats describes the outcome of a recovery attempt
+type RecoveryStats struct {
+	Recovered bool
+
+	// Rounds is the propagation depth, the number of waves of recovered
+	// lines that reconstructed any cell. The first wave holds the lines
+	// recoverable from the samples alone and every further wave the lines
+	// that became recoverable from the cells of the previous one.
+	// It is 0 when there were too few samples to attempt recovery, unless
+	// AlwaysPropagate is set
+	Rounds int
+}
+
+// RecoverWithStats attempts to recover the entire DataSquare and reports how
+// many propagation waves it took
+func (ds *DataSquare) RecoverWithStats() RecoveryStats {
+	var stats RecoveryStats
+	if possible, _ := ds.Recoverable(); !possible && !ds.AlwaysPropagate {
+		return stats
+	}
+
+	wave := ds.wave[:0]
+	for row := 0; row < ds.ColLen; row++ {
+		if !ds.RecoveredRows[row] && ds.RowCounts[row] >= ds.RowThreshold {
+			wave = append(wave, line{index: row})
+		}
+	}
+	for col := 0; col < ds.RowLen; col++ {
+		if !ds.RecoveredCols[col] && ds.ColCounts[col] >= ds.ColThreshold {
+			wave = append(wave, line{index: col, col: true})
+		}
+	}
+
+	next := ds.nextWave[:0]
+	for len(wave) > 0 {
+		present := ds.TotalCount
+		for _, l := range wave {
+			next = ds.recoverLine(l, next)
+		}
+		if ds.TotalCount > present {
+			stats.Rounds++
+		}
+		wave, next = next, wave[:0]
+	}
+	ds.wave, ds.nextWave = wave, next
+
+	stats.Recovered = ds.IsRecovered()
+	return stats
+}
+
+// recoverLine fills every cell of l without cascading and appends the
+// crossing lines that its cells made recoverable to next
+func (ds *DataSquare) recoverLine(l line, next []line) []line {
+	if l.col {
+		ds.RecoveredCols[l.index] = true
+		for row := 0; row < ds.ColLen; row++ {
+			// a row becomes recoverable exactly when its count reaches the threshold
+			if ds.fill(row, l.index) && ds.RowCounts[row] == ds.RowThreshold && !ds.RecoveredRows[row] {
+				next = append(next, line{index: row})
+			}
+		}
+		return next
+	}
+
+	ds.RecoveredRows[l.index] = true
+	for col := 0; col < ds.RowLen; col++ {
+		if ds.fill(l.index, col) && ds.ColCounts[col] == ds.ColThreshold && !ds.RecoveredCols[col] {
+			next = append(next, line{index: col, col: true})
+		}
+	}
+	return next
+}
+
+// RecoverSquare runs row and column recovery on a caller-supplied matrix in
+// which every non-zero cell is present, with threshold samples needed to
+// recover a row or column. It returns a copy of the matrix with every
+// reconstructed cell set to 1, which is fully filled when ok is true.
+// The propagation is the one DataSquare.Recover performs; a threshold
+// outside 1 and the shorter side of the matrix, or rows of different
+// lengths, recover nothing.
+func RecoverSquare(matrix [][]int, threshold int) (recovered [][]int, ok bool) {
+	recovered = make([][]int, len(matrix))
+	for row := range matrix {
+		recovered[row] = slices.Clone(matrix[row])
+	}
+	if len(matrix) == 0 {
+		return recovered, true
+	}
+
+	for _, row := range matrix {
+		if len(row) != len(matrix[0]) {
+			return recovered, false
+		}
+	}
+
+	ds := newRegion(len(matrix[0]), len(matrix))
+	// report partial recovery even below the sample count threshold
+	ds.AlwaysPropagate = true
+	if ds.SetRecoveryThreshold(threshold) != nil {
+		return recovered, false
+	}
+
+	for row := range matrix {
+		for col, v := range matrix[row] {
+			if v != 0 {
+				ds.AddSample(row, col)
+			}
+		}
+	}
+
+	ok = ds.Recover()
+	for row := range recovered {
+		for col := range recovered[row] {
+			if recovered[row][col] == 0 && (ok || ds.Get(row, col)) {
+				recovered[row][col] = 1
+			}
+		}
+	}
+	return recovered, ok
+}
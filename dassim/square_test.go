@@ -0,0 +1,92 @@
+package dassim
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestAddSamplesSkipsDuplicates(t *testing.T) {
+	ds := NewDataSquare(16)
+	samples := NewSampleSet(10)
+	samples.FillUnique(10, 16, rand.New(rand.NewSource(1)), UniformDistribution{})
+
+	if added := ds.AddSamples(samples); added != 10 {
+		t.Fatalf("first AddSamples added %d samples, want 10", added)
+	}
+	if added := ds.AddSamples(samples); added != 0 {
+		t.Fatalf("second AddSamples added %d samples, want 0", added)
+	}
+	if ds.TotalCount != 10 {
+		t.Fatalf("TotalCount is %d, want 10", ds.TotalCount)
+	}
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+	build := func() *DataSquare {
+		ds := NewDataSquare(4)
+		ds.RecordSamples = true
+		ds.Withheld[Sample{Row: 7, Col: 7}] = true
+		for col := 0; col < 4; col++ {
+			ds.AddSample(0, col)
+		}
+		// leaves spare capacity in the sample log
+		ds.AddSample(1, 0)
+		ds.Recover()
+		return ds
+	}
+
+	ds := build()
+	clone := ds.Clone()
+	clone.AddSample(5, 5)
+	clone.Set(6, 6)
+	clone.RowCounts[1]++
+	clone.ColCounts[1]++
+	clone.RecoveredRows[3] = true
+	clone.RecoveredCols[3] = true
+	clone.Withheld[Sample{Row: 2, Col: 2}] = true
+
+	if !reflect.DeepEqual(ds, build()) {
+		t.Fatalf("mutating the clone changed the source")
+	}
+
+	// appending to the source log must not overwrite the clone's
+	ds.AddSample(4, 4)
+	if log := clone.SampleLog(); log[len(log)-1] != (Sample{Row: 5, Col: 5}) {
+		t.Fatalf("the sample log of the clone is shared with the source: %v", log)
+	}
+}
+
+func BenchmarkReset(b *testing.B) {
+	ds := NewDataSquare(128)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ds.AddSample(i%256, i%256)
+		ds.Reset()
+	}
+}
+
+func TestRecoverWithStatsCountsWaves(t *testing.T) {
+	ds := NewDataSquare(2)
+	for _, s := range []Sample{{0, 0}, {0, 1}, {1, 2}, {2, 3}} {
+		ds.AddSample(s.Row, s.Col)
+	}
+
+	// row 0, then columns 2 and 3, then rows 1 to 3
+	stats := ds.RecoverWithStats()
+	if !stats.Recovered || stats.Rounds != 3 {
+		t.Fatalf("RecoverWithStats returned %+v, want recovered in 3 rounds", stats)
+	}
+}
+
+func TestRecoverSquareRejectsRaggedMatrix(t *testing.T) {
+	for _, matrix := range [][][]int{
+		{{1, 1}, {1, 1, 1}},
+		{{1, 1, 1}, {1, 1}},
+	} {
+		recovered, ok := RecoverSquare(matrix, 1)
+		if ok || !equalMatrix(recovered, matrix) {
+			t.Fatalf("RecoverSquare(%v) = %v, %v, want the matrix unchanged and false", matrix, recovered, ok)
+		}
+	}
+}
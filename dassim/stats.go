@@ -0,0 +1,57 @@
+package dassim
+
+import "math"
+
+// z95 is the standard normal quantile for a two-sided 95% confidence level
+const z95 = 1.959963984540054
+
+// WilsonInterval returns the Wilson score confidence interval for a success
+// rate of successes out of trials, at the confidence level given by the
+// normal quantile z (e.g. 1.96 for 95%)
+func WilsonInterval(successes, trials int, z float64) (lower, upper float64) {
+	if trials == 0 {
+		return 0, 1
+	}
+
+	n := float64(trials)
+	p := float64(successes) / n
+	z2 := z * z
+
+	center := (p + z2/(2*n)) / (1 + z2/n)
+	halfWidth := z / (1 + z2/n) * math.Sqrt(p*(1-p)/n+z2/(4*n*n))
+	return max(0, center-halfWidth), min(1, center+halfWidth)
+}
+
+// meanStdDev returns the mean and sample standard deviation of values
+// The standard deviation is 0 for fewer than two values
+func meanStdDev(values []int) (mean, stddev float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+
+	for _, v := range values {
+		mean += float64(v)
+	}
+	mean /= float64(len(values))
+
+	if len(values) < 2 {
+		return mean, 0
+	}
+
+	var sum float64
+	for _, v := range values {
+		d := float64(v) - mean
+		sum += d * d
+	}
+	return mean, math.Sqrt(sum / float64(len(values)-1))
+}
+
+// percentile returns the nearest-rank p-th percentile, p in (0,1], of the
+// ascending values, or 0 when there are none
+func percentile(sorted []int, p float64) int {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	return sorted[min(max(rank, 1), len(sorted))-1]
+}
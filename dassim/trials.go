@@ -0,0 +1,378 @@
+package dassim
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// probeStats accumulates the outcomes of the trials of a single probe
+type probeStats struct {
+	successCount int
+	iterations   int
+
+	// samples is the number of samples requested by all light nodes and
+	// distinct the number of cells they placed in the square
+	samples  int
+	distinct int
+
+	// minRounds, maxRounds and totalRounds cover the recovery rounds of the
+	// successful trials
+	minRounds, maxRounds, totalRounds int
+}
+
+// add records the outcome of a single trial
+func (p *probeStats) add(o trialOutcome) {
+	if o.recovered {
+		if p.successCount == 0 || o.rounds < p.minRounds {
+			p.minRounds = o.rounds
+		}
+		p.maxRounds = max(p.maxRounds, o.rounds)
+		p.totalRounds += o.rounds
+		p.successCount++
+	}
+	p.iterations++
+	p.samples += o.samples
+	p.distinct += o.distinct
+}
+
+// merge adds the trials accumulated in o
+func (p *probeStats) merge(o probeStats) {
+	if o.successCount > 0 && (p.successCount == 0 || o.minRounds < p.minRounds) {
+		p.minRounds = o.minRounds
+	}
+	p.maxRounds = max(p.maxRounds, o.maxRounds)
+	p.totalRounds += o.totalRounds
+	p.successCount += o.successCount
+	p.iterations += o.iterations
+	p.samples += o.samples
+	p.distinct += o.distinct
+}
+
+// runProbe runs the recovery trials for a single size and lights count and
+// returns their accumulated outcomes. With AdaptiveIterations set, trials
+// run in batches of config.Iterations until the 95% Wilson interval is
+// narrower than 2*Precision or MaxIterations is reached; otherwise exactly
+// config.Iterations trials run.
+func runProbe(ctx context.Context, config *SimulationConfig, size, lights int, seed int64) (probeStats, error) {
+	if !config.AdaptiveIterations {
+		return runTrials(ctx, config, size, lights, seed, 0, config.Iterations)
+	}
+
+	var stats probeStats
+	maxIterations := max(config.MaxIterations, config.Iterations)
+	for stats.iterations < maxIterations {
+		batch := min(config.Iterations, maxIterations-stats.iterations)
+		batchStats, err := runTrials(ctx, config, size, lights, seed, stats.iterations, stats.iterations+batch)
+		if err != nil {
+			return probeStats{}, err
+		}
+		stats.merge(batchStats)
+
+		lower, upper := WilsonInterval(stats.successCount, stats.iterations, z95)
+		if (upper-lower)/2 < config.Precision {
+			break
+		}
+	}
+	return stats, nil
+}
+
+// runTrials runs trials start through end-1 for the given size and lights
+// count and returns their accumulated outcomes. Trial i is sampled from a
+// seed derived from seed, size, lights and i alone, so its outcome does not
+// depend on any other probe. It stops early with ctx.Err() once ctx is done.
+func runTrials(ctx context.Context, config *SimulationConfig, size, lights int, seed int64, start, end int) (probeStats, error) {
+	outcomes := make([]trialOutcome, end-start)
+	probeSeed := deriveSeed(seed, int64(size), int64(lights))
+	err := forEachTrial(ctx, config, size, probeSeed, start, end, func(t *trialState, i int) {
+		outcomes[i-start] = t.run(config, lights)
+	})
+	if err != nil {
+		return probeStats{}, err
+	}
+
+	var stats probeStats
+	for _, o := range outcomes {
+		stats.add(o)
+	}
+	return stats, nil
+}
+
+// forEachTrial calls trial for every trial i from start through end-1, on
+// all CPU cores when config.Parallel is set. Each worker reuses its
+// trialState, whose rng is reseeded with deriveSeed(seed, i) before trial i,
+// so the outcomes do not depend on how trials are scheduled across workers.
+// It stops early with ctx.Err() once ctx is done.
+func forEachTrial(ctx context.Context, config *SimulationConfig, size int, seed int64, start, end int, trial func(t *trialState, i int)) error {
+	workers := 1
+	if config.Parallel {
+		workers = min(runtime.NumCPU(), end-start)
+	}
+
+	var (
+		next atomic.Int64
+		wg   sync.WaitGroup
+	)
+	next.Store(int64(start))
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			t := newTrialState(config, size, rand.New(rand.NewSource(seed)))
+			for {
+				i := next.Add(1) - 1
+				if i >= int64(end) || ctx.Err() != nil {
+					return
+				}
+
+				t.rng.Seed(deriveSeed(seed, i))
+				trial(t, int(i))
+			}
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// ReplayTrial reruns trial i of the probe of the given size and lights count
+// that was sampled from seed, the Seed of its SimulationResult, and returns
+// its square with RecordSamples set. SampleLog then lists the samples of the
+// trial in the order they were placed, and the square is left as recovery
+// left it. A Distribution or SamplesPerNode must be set in config as it was
+// in the original run.
+func ReplayTrial(config *SimulationConfig, size, lights int, seed int64, i int) *DataSquare {
+	probeSeed := deriveSeed(seed, int64(size), int64(lights))
+	t := newTrialState(config, size, rand.New(rand.NewSource(deriveSeed(probeSeed, int64(i)))))
+	t.ds.RecordSamples = true
+	t.run(config, lights)
+	return t.ds
+}
+
+// SimulateOnce runs a single recovery trial on a fresh square of the given
+// size with lights rounds of samplesPerIter unique samples and reports
+// whether the square could be recovered. All other options take their
+// NewDefaultConfig values.
+func SimulateOnce(size, lights, samplesPerIter int, rng *rand.Rand) bool {
+	config := NewDefaultConfig()
+	config.SamplesPerIteration = samplesPerIter
+	return newTrialState(config, size, rng).run(config, lights).recovered
+}
+
+// trialState holds the square and scratch sets a single worker reuses
+// across trials
+type trialState struct {
+	size     int
+	ds       *DataSquare
+	samples  *SampleSet
+	withheld *SampleSet
+	node     []Sample
+	rng      *rand.Rand
+}
+
+// newTrialState allocates the state for running trials of the given size
+func newTrialState(config *SimulationConfig, size int, rng *rand.Rand) *trialState {
+	var ds *DataSquare
+	if config.Dimension == OneD {
+		ds = newDataVector(size, config.recoveryThreshold(size))
+	} else {
+		ds = NewDataSquare(size)
+		ds.RowThreshold = config.recoveryThreshold(size)
+		ds.ColThreshold = ds.RowThreshold
+	}
+	ds.AlwaysPropagate = config.AlwaysPropagate
+
+	return &trialState{
+		size:     size,
+		ds:       ds,
+		samples:  NewSampleSet(config.SamplesPerIteration),
+		withheld: NewSampleSet(0),
+		node:     make([]Sample, 0, config.SamplesPerIteration),
+		rng:      rng,
+	}
+}
+
+// trialOutcome is the outcome of a single trial
+type trialOutcome struct {
+	recovered bool
+
+	// rounds is the number of recovery propagation waves
+	rounds int
+
+	// samples is the number of samples requested by all light nodes and
+	// distinct the number of cells they placed before recovery, which is
+	// lower because of collisions, withheld cells and lost samples
+	samples  int
+	distinct int
+}
+
+// run resets the square, withholds cells and places the samples of lights
+// light nodes according to config, and reports whether the square could be
+// recovered
+func (t *trialState) run(config *SimulationConfig, lights int) trialOutcome {
+	var outcome trialOutcome
+	ds, samples, rng, size := t.ds, t.samples, t.rng, t.size
+	t.reset(config)
+
+	dist := config.distribution()
+	switch config.SamplingModel {
+	case SharedUnique:
+		for n := 0; n < lights; n++ {
+			outcome.samples += t.nodeSamples(config)
+		}
+		if config.WithReplacement {
+			samples.FillRandom(outcome.samples, size, rng, dist)
+		} else {
+			samples.FillUnique(min(outcome.samples, config.sampleableCells(size)), size, rng, dist)
+		}
+		if config.LossProbability > 0 || ds.RecordSamples {
+			// drops consume the rng and the log is replayed, so visit
+			// samples in a deterministic order
+			for _, s := range samples.Sorted() {
+				t.deliver(config, s)
+			}
+		} else {
+			ds.AddSamples(samples)
+		}
+		samples.Clear()
+	default:
+		for n := 0; n < lights; n++ {
+			outcome.samples += t.addNode(config, dist)
+		}
+	}
+
+	outcome.distinct = ds.TotalCount
+	recovery := ds.RecoverWithStats()
+	outcome.recovered, outcome.rounds = recovery.Recovered, recovery.Rounds
+	return outcome
+}
+
+// reset clears the square and withholds the cells of a new trial
+func (t *trialState) reset(config *SimulationConfig) {
+	t.ds.Reset()
+	t.samples.Clear()
+	if config.WithheldFraction > 0 || config.WithheldColumns > 0 {
+		t.withheld.Clear()
+		t.withheld.FillUnique(int(config.WithheldFraction*float64(config.extendedCells(t.size))), t.size, t.rng, config.withholdDistribution())
+		t.withholdColumns(min(config.WithheldColumns, t.ds.RowLen))
+		t.ds.Withhold(t.withheld)
+	}
+}
+
+// withholdColumns adds every cell of n distinct random columns to the
+// withheld set
+func (t *trialState) withholdColumns(n int) {
+	if n == 0 {
+		return
+	}
+
+	cols := t.rng.Perm(t.ds.RowLen)[:n]
+	for _, col := range cols {
+		for row := 0; row < t.ds.ColLen; row++ {
+			t.withheld.samples[Sample{Row: row, Col: col}] = true
+		}
+	}
+}
+
+// addNode places the samples of one more independent light node drawn from
+// dist and returns how many it requested
+func (t *trialState) addNode(config *SimulationConfig, dist Distribution) int {
+	count := t.nodeSamples(config)
+	if config.WithReplacement {
+		t.node = appendRandom(t.node[:0], count, t.size, t.rng, dist)
+	} else {
+		t.node = appendUnique(t.node[:0], count, t.size, t.rng, dist, t.samples)
+	}
+	for _, s := range t.node {
+		t.deliver(config, s)
+	}
+	return count
+}
+
+// addSharedNode places the samples of one more light node drawing from the
+// shared pool of SharedUnique, skipping cells earlier nodes already drew
+// unless config.WithReplacement is set, and returns how many it requested
+func (t *trialState) addSharedNode(config *SimulationConfig, dist Distribution) int {
+	count := t.nodeSamples(config)
+	if !config.WithReplacement {
+		count = min(count, config.sampleableCells(t.size)-len(t.samples.samples))
+	}
+	for n := count; n > 0; {
+		row, col := dist.Sample(t.rng, t.size)
+		s := Sample{Row: row, Col: col}
+		if config.WithReplacement || !t.samples.samples[s] {
+			t.samples.samples[s] = true
+			t.deliver(config, s)
+			n--
+		}
+	}
+	return count
+}
+
+// nodeSamples returns how many unique samples the next light node takes,
+// drawn from config.SamplesPerNode when set. Unique samples are capped at
+// the cells the node may sample.
+func (t *trialState) nodeSamples(config *SimulationConfig) int {
+	n := config.SamplesPerIteration
+	if config.SamplesPerNode != nil {
+		n = max(config.SamplesPerNode(t.rng), 0)
+	}
+	if config.WithReplacement {
+		return n
+	}
+	return min(n, config.sampleableCells(t.size))
+}
+
+// deliver records a sample in the square unless the network loses it,
+// which happens with config.LossProbability
+func (t *trialState) deliver(config *SimulationConfig, s Sample) {
+	if config.LossProbability > 0 && t.rng.Float64() < config.LossProbability {
+		return
+	}
+	t.ds.addSampled(s)
+}
+
+// linearScanSamples is the batch size up to which appendUnique deduplicates
+// with a linear scan rather than a set
+const linearScanSamples = 32
+
+// appendUnique appends n random samples within the given size bounds to dst
+// that are unique within the appended batch. It draws exactly like
+// SampleSet.FillUnique on an empty set, but deduplicates small batches with
+// a linear scan, which beats hashing for the handful of samples a light node
+// takes. Larger batches are deduplicated with seen, which is left empty.
+func appendUnique(dst []Sample, n, size int, rng *rand.Rand, dist Distribution, seen *SampleSet) []Sample {
+	start, hashed := len(dst), n > linearScanSamples
+	if hashed {
+		defer seen.Clear()
+	}
+	for n > 0 {
+		row, col := dist.Sample(rng, size)
+		sample := Sample{Row: row, Col: col}
+
+		if hashed {
+			if seen.samples[sample] {
+				continue
+			}
+			seen.samples[sample] = true
+		} else if slices.Contains(dst[start:], sample) {
+			continue
+		}
+		dst = append(dst, sample)
+		n--
+	}
+	return dst
+}
+
+// appendRandom appends n random samples within the given size bounds to dst,
+// drawn with replacement so the batch may hold duplicates
+func appendRandom(dst []Sample, n, size int, rng *rand.Rand, dist Distribution) []Sample {
+	for ; n > 0; n-- {
+		row, col := dist.Sample(rng, size)
+		dst = append(dst, Sample{Row: row, Col: col})
+	}
+	return dst
+}
@@ -0,0 +1,57 @@
+package dassim
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+)
+
+func BenchmarkTrial(b *testing.B) {
+	config := NewDefaultConfig()
+	t := newTrialState(config, 64, rand.New(rand.NewSource(1)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		t.run(config, 120)
+	}
+}
+
+func BenchmarkTrialManySamples(b *testing.B) {
+	config := NewDefaultConfig()
+	config.SamplesPerIteration = 4000
+	t := newTrialState(config, 64, rand.New(rand.NewSource(1)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		t.run(config, 4)
+	}
+}
+
+func TestAppendUniqueDrawsLikeFillUnique(t *testing.T) {
+	for _, n := range []int{linearScanSamples, 4000} {
+		set := NewSampleSet(n)
+		set.FillUnique(n, 64, rand.New(rand.NewSource(3)), UniformDistribution{})
+
+		batch := appendUnique(nil, n, 64, rand.New(rand.NewSource(3)), UniformDistribution{}, NewSampleSet(n))
+		if len(batch) != n || len(set.samples) != n {
+			t.Fatalf("got %d and %d samples, want %d", len(batch), len(set.samples), n)
+		}
+		for _, s := range batch {
+			if !set.samples[s] {
+				t.Fatalf("appendUnique drew %v, which FillUnique did not for %d samples", s, n)
+			}
+		}
+	}
+}
+
+func TestRoundStatsVaryNearThreshold(t *testing.T) {
+	config := NewDefaultConfig()
+	config.Iterations = 200
+	stats, err := runProbe(context.Background(), config, 16, 28, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rounds := config.newResult(16, 28, stats, 5).RoundStats
+	if rounds.Min < 1 || rounds.Max <= rounds.Min {
+		t.Fatalf("RoundStats %+v near the threshold, want rounds spread above 1", rounds)
+	}
+}
@@ -1,274 +1,330 @@
 package main
 
 import (
-	"log"
-	"math/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/walldiss/Celestia-DAS-simulations/dassim"
 )
 
-// Sample represents a single point in the data square
-type Sample struct {
-	Row, Col int
-}
+// outputOptions holds the command-line options that control where results
+// are written, as opposed to how the simulation runs
+type outputOptions struct {
+	csvPath          string
+	aggregateCSVPath string
+	jsonPath         string
 
-// SampleSet maintains a collection of unique samples
-type SampleSet struct {
-	samples map[Sample]bool
-}
+	// resumePath, if set, continues the simulation checkpointed in that
+	// file instead of starting a new one
+	resumePath string
 
-// NewSampleSet creates a new initialized SampleSet
-func NewSampleSet(capacity int) *SampleSet {
-	return &SampleSet{
-		samples: make(map[Sample]bool, capacity),
-	}
-}
+	// requiredLights measures the distribution of the lights each trial
+	// needs to recover instead of searching for thresholds
+	requiredLights bool
 
-// Clear removes all samples from the set
-func (s *SampleSet) Clear() {
-	clear(s.samples)
+	// serveAddr, if set, serves simulations over HTTP on that address
+	// instead of running one
+	serveAddr string
 }
 
-// FillUnique adds n unique random samples within the given size bounds
-func (s *SampleSet) FillUnique(n, size int) {
-	for n > 0 {
-		row := rand.Intn(size * 2)
-		col := rand.Intn(size * 2)
-		sample := Sample{Row: row, Col: col}
+// parseFlags builds a SimulationConfig from command-line arguments. Flags
+// that are not set take their value from the -config file if one is given,
+// or from NewDefaultConfig otherwise.
+func parseFlags(args []string) (*dassim.SimulationConfig, *outputOptions, error) {
+	var (
+		config     = dassim.NewDefaultConfig()
+		output     = &outputOptions{}
+		cluster    dassim.ClusteredDistribution
+		configPath string
+	)
+
+	fs := newFlagSet(config, output, &cluster, &configPath)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
 
-		if !s.samples[sample] {
-			s.samples[sample] = true
-			n--
+	if configPath != "" {
+		loaded, err := dassim.LoadConfig(configPath)
+		if err != nil {
+			fmt.Fprintln(fs.Output(), "error:", err)
+			return nil, nil, err
 		}
+
+		// explicitly set flags take precedence over the file
+		overrides := newFlagSet(loaded, output, &cluster, &configPath)
+		fs.Visit(func(f *flag.Flag) {
+			if err == nil {
+				err = overrides.Set(f.Name, f.Value.String())
+			}
+		})
+		if err != nil {
+			fmt.Fprintln(fs.Output(), "error:", err)
+			return nil, nil, err
+		}
+		config = loaded
 	}
+
+	if cluster.Weight > 0 {
+		config.Distribution = cluster
+	}
+	return config, output, nil
 }
 
-// DataSquare represents the main data structure for the recovery simulation
-type DataSquare struct {
-	Size          int
-	Matrix        [][]int
-	RowCounts     []int
-	ColCounts     []int
-	RecoveredRows map[int]bool
-	RecoveredCols map[int]bool
-	TotalCount    int
+// newFlagSet creates the command-line flags, binding them to the given
+// config and options with their current values as defaults
+func newFlagSet(config *dassim.SimulationConfig, output *outputOptions, cluster *dassim.ClusteredDistribution, configPath *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("das-simulations", flag.ContinueOnError)
+	fs.StringVar(configPath, "config", *configPath, "load the simulation config from this JSON file, explicit flags override it")
+	fs.IntVar(&config.SamplesPerIteration, "samples-per-iter", config.SamplesPerIteration, "number of unique samples per light node")
+	fs.IntVar(&config.Iterations, "iterations", config.Iterations, "number of trials per lights count")
+	fs.BoolVar(&config.AdaptiveIterations, "adaptive", config.AdaptiveIterations, "run batches of -iterations trials until the confidence interval is narrow enough")
+	fs.Float64Var(&config.Precision, "precision", config.Precision, "confidence interval half-width at which -adaptive stops")
+	fs.IntVar(&config.MaxIterations, "max-iterations", config.MaxIterations, "trial ceiling per lights count with -adaptive")
+	fs.IntVar(&config.InitialLights, "initial-lights", config.InitialLights, "starting number of light nodes, used when -lights-at-16 is 0")
+	fs.IntVar(&config.LightsAt16, "lights-at-16", config.LightsAt16, "starting lights at size 16, scaled by size^2 for other sizes")
+	fs.IntVar(&config.SizeIterFactor, "size-iter-factor", config.SizeIterFactor, "lights are incremented by size/size-iter-factor per step")
+	fs.IntVar(&config.InitialSize, "initial-size", config.InitialSize, "starting size k of the original data square (power of two)")
+	fs.IntVar(&config.MaxSize, "max-size", config.MaxSize, "largest size k to simulate")
+	fs.Var((*intList)(&config.Sizes), "sizes", "comma-separated sizes k to simulate in order, replacing -initial-size and -max-size")
+	fs.IntVar(&config.MaxLights, "max-lights", config.MaxLights, "largest lights count to probe per size, 0 uses 4*size^2")
+	fs.Float64Var(&config.TargetProbability, "target-prob", config.TargetProbability, "success rate to reach before moving to the next size, in (0,1]")
+	fs.Var((*float64List)(&config.TargetProbabilities), "target-probs", "comma-separated ascending success rates to record thresholds for, replacing -target-prob")
+	fs.IntVar(&config.RecoveryThreshold, "recovery-threshold", config.RecoveryThreshold, "samples needed to recover a row or column, 0 uses the size k")
+	fs.BoolVar(&config.AlwaysPropagate, "always-propagate", config.AlwaysPropagate, "run recovery even when too few samples are present for it to succeed")
+	fs.Float64Var(&config.WithheldFraction, "withheld", config.WithheldFraction, "fraction of cells withheld by the block producer, in [0,1)")
+	fs.IntVar(&config.WithheldColumns, "withheld-columns", config.WithheldColumns, "number of random whole columns withheld by the block producer")
+	fs.Float64Var(&config.LossProbability, "loss", config.LossProbability, "probability that a requested sample is lost in the network, in [0,1)")
+	fs.Float64Var(&cluster.Weight, "cluster-weight", 0, "probability that a sample falls in the cluster block, 0 samples uniformly")
+	fs.Float64Var(&cluster.Origin, "cluster-origin", 0, "start of the cluster block as a fraction of the extended width")
+	fs.Float64Var(&cluster.Extent, "cluster-extent", 0.5, "side of the cluster block as a fraction of the extended width")
+	fs.TextVar(&config.SampleRegion, "region", config.SampleRegion, "sampled region: full or original")
+	fs.TextVar(&config.Dimension, "dimension", config.Dimension, "erasure coding scheme: 2d or a 1d baseline vector of 2k cells")
+	fs.TextVar(&config.SamplingModel, "sampling", config.SamplingModel, "sampling model: per-node or shared-unique")
+	fs.Var((*modelList)(&config.CompareModels), "compare-models", "comma-separated sampling models to run the sweep once each for, replacing -sampling")
+	fs.BoolVar(&config.WithReplacement, "with-replacement", config.WithReplacement, "let light nodes draw samples with replacement, so they may request a cell twice")
+	fs.IntVar(&config.Repeats, "repeats", config.Repeats, "number of sweeps to run with derived seeds for threshold statistics")
+	fs.BoolVar(&config.ConservativeThreshold, "conservative", config.ConservativeThreshold, "require the 95% lower confidence bound to reach -target-prob")
+	fs.TextVar(&config.SearchStrategy, "search", config.SearchStrategy, "threshold search strategy: linear or binary")
+	fs.TextVar(&config.SweepVariable, "sweep", config.SweepVariable, "quantity to search per size: lights, or samples-per-node at the initial lights count")
+	fs.BoolVar(&config.Parallel, "parallel", config.Parallel, "run iterations on all CPU cores")
+	fs.IntVar(&config.ParallelSizes, "parallel-sizes", config.ParallelSizes, "number of sizes to simulate concurrently")
+	fs.Int64Var(&config.Seed, "seed", config.Seed, "random seed, 0 picks a time-based seed")
+	fs.BoolVar(&config.Verbose, "verbose", config.Verbose, "log progress while running")
+	fs.StringVar(&config.CheckpointPath, "checkpoint", config.CheckpointPath, "periodically save progress to this file so -resume can continue it")
+	fs.IntVar(&config.CheckpointEvery, "checkpoint-every", config.CheckpointEvery, "number of probes between -checkpoint writes")
+	fs.StringVar(&output.resumePath, "resume", "", "continue the simulation saved in this checkpoint file, ignoring the other simulation flags")
+	fs.StringVar(&output.jsonPath, "json", "", "write results and the effective config as JSON to this file, or to stdout when -")
+	fs.StringVar(&output.csvPath, "csv", "", "write results as CSV to this file, or to stdout when -")
+	fs.StringVar(&output.aggregateCSVPath, "aggregate-csv", "", "write per-size threshold statistics across repeats as CSV to this file, or to stdout when -")
+	fs.BoolVar(&output.requiredLights, "required", false, "measure the percentiles of the lights each trial needs to recover instead of searching thresholds")
+	fs.StringVar(&output.serveAddr, "serve", "", "serve POST /simulate and GET /defaults over HTTP on this address, e.g. :8080")
+	return fs
 }
 
-// NewDataSquare creates a new initialized DataSquare
-func NewDataSquare(size int) *DataSquare {
-	matrix := make([][]int, 2*size)
-	for i := range matrix {
-		matrix[i] = make([]int, 2*size)
-	}
+// float64List is a flag.Value holding a comma-separated list of floats
+type float64List []float64
 
-	return &DataSquare{
-		Size:          size,
-		Matrix:        matrix,
-		RecoveredRows: make(map[int]bool),
-		RecoveredCols: make(map[int]bool),
+func (l *float64List) String() string {
+	parts := make([]string, len(*l))
+	for i, v := range *l {
+		parts[i] = strconv.FormatFloat(v, 'g', -1, 64)
 	}
+	return strings.Join(parts, ",")
 }
 
-// Reset clears all data in the DataSquare
-func (ds *DataSquare) Reset() {
-	ds.RowCounts = make([]int, ds.Size*2)
-	ds.ColCounts = make([]int, ds.Size*2)
-	clear(ds.RecoveredRows)
-	clear(ds.RecoveredCols)
-	ds.TotalCount = 0
-
-	for i := range ds.Matrix {
-		for j := range ds.Matrix[i] {
-			ds.Matrix[i][j] = 0
+func (l *float64List) Set(s string) error {
+	*l = nil
+	for _, part := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return err
 		}
+		*l = append(*l, v)
 	}
+	return nil
 }
 
-// AddSamples adds all samples from the given set to the DataSquare
-func (ds *DataSquare) AddSamples(samples *SampleSet) {
-	for s := range samples.samples {
-		if ds.Matrix[s.Row][s.Col] == 0 {
-			ds.AddSample(s.Row, s.Col)
-		}
+// intList is a flag.Value holding a comma-separated list of integers
+type intList []int
+
+func (l *intList) String() string {
+	parts := make([]string, len(*l))
+	for i, v := range *l {
+		parts[i] = strconv.Itoa(v)
 	}
+	return strings.Join(parts, ",")
 }
 
-// AddSample adds a single sample to the DataSquare
-func (ds *DataSquare) AddSample(row, col int) bool {
-	if ds.Matrix[row][col] > 0 {
-		return false
+func (l *intList) Set(s string) error {
+	*l = nil
+	for _, part := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return err
+		}
+		*l = append(*l, v)
 	}
-
-	ds.Matrix[row][col] = 1
-	ds.RowCounts[row]++
-	ds.ColCounts[col]++
-	ds.TotalCount++
-	return true
+	return nil
 }
 
-// TryRecoverRow attempts to recover a row if it meets the criteria
-func (ds *DataSquare) TryRecoverRow(row int) bool {
-	if ds.RecoveredRows[row] {
-		return false
+// modelList is a flag.Value holding a comma-separated list of sampling models
+type modelList []dassim.SamplingModel
+
+func (l *modelList) String() string {
+	parts := make([]string, len(*l))
+	for i, m := range *l {
+		parts[i] = m.String()
 	}
+	return strings.Join(parts, ",")
+}
 
-	if ds.RowCounts[row] >= ds.Size {
-		ds.RecoveredRows[row] = true
-		for col := range ds.Matrix[row] {
-			if ds.AddSample(row, col) {
-				ds.TryRecoverCol(col)
-			}
+func (l *modelList) Set(s string) error {
+	*l = nil
+	for _, part := range strings.Split(s, ",") {
+		var m dassim.SamplingModel
+		if err := m.UnmarshalText([]byte(strings.TrimSpace(part))); err != nil {
+			return err
 		}
-		return true
+		*l = append(*l, m)
 	}
-	return false
+	return nil
 }
 
-// TryRecoverCol attempts to recover a column if it meets the criteria
-func (ds *DataSquare) TryRecoverCol(col int) bool {
-	if ds.RecoveredCols[col] {
-		return false
+func main() {
+	config, output, err := parseFlags(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		// the flag set has already reported the problem and usage
+		os.Exit(2)
+	}
+	if err := config.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(2)
 	}
 
-	if ds.ColCounts[col] >= ds.Size {
-		ds.RecoveredCols[col] = true
-		for row := range ds.Matrix {
-			if ds.AddSample(row, col) {
-				ds.TryRecoverRow(row)
-			}
+	if output.serveAddr != "" {
+		if err := serve(output.serveAddr); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
 		}
-		return true
+		return
 	}
-	return false
-}
-
-// IsRecovered checks if the DataSquare is fully recovered
-func (ds *DataSquare) IsRecovered() bool {
-	return len(ds.RecoveredRows) >= ds.Size || len(ds.RecoveredCols) >= ds.Size
-}
 
-// Recover attempts to recover the entire DataSquare
-func (ds *DataSquare) Recover() bool {
-	if ds.TotalCount < ds.Size*ds.Size {
-		return false
+	if output.requiredLights {
+		required, err := dassim.RunRequiredLights(config)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		if !config.Verbose {
+			// verbose runs have already logged every size, and stdout may
+			// carry the JSON output
+			for _, r := range required {
+				fmt.Fprintf(os.Stderr, "size %d: p50 %d, p90 %d, p99 %d lights (%d/%d unrecovered)\n",
+					r.Size, r.P50, r.P90, r.P99, r.Unrecovered, r.Trials)
+			}
+		}
+		if output.jsonPath != "" {
+			err := writeOutput(output.jsonPath, func(w io.Writer) error {
+				enc := json.NewEncoder(w)
+				enc.SetIndent("", "  ")
+				return enc.Encode(required)
+			})
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error: writing JSON:", err)
+				os.Exit(1)
+			}
+		}
+		return
 	}
 
-	for {
-		var rowRecovered, colRecovered bool
-		for i := 0; i < ds.Size*2; i++ {
-			rowRecovered = ds.TryRecoverRow(i) || rowRecovered
-			colRecovered = ds.TryRecoverCol(i) || colRecovered
+	var results []dassim.SimulationResult
+	if output.resumePath != "" {
+		if config, err = checkpointConfig(output.resumePath); err == nil {
+			results, err = dassim.ResumeSimulation(output.resumePath)
 		}
+	} else {
+		results, err = dassim.RunSimulation(config)
+	}
+	switch {
+	case errors.Is(err, dassim.ErrThresholdNotReached):
+		// the results of the other sizes are still worth writing
+		fmt.Fprintln(os.Stderr, "warning:", err)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
 
-		if ds.IsRecovered() {
-			return true
+	if output.csvPath != "" {
+		err := writeOutput(output.csvPath, func(w io.Writer) error {
+			return dassim.WriteCSV(w, results)
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error: writing CSV:", err)
+			os.Exit(1)
 		}
-		if !rowRecovered && !colRecovered {
-			return false
+	}
+	if output.aggregateCSVPath != "" {
+		err := writeOutput(output.aggregateCSVPath, func(w io.Writer) error {
+			return dassim.WriteAggregateCSV(w, dassim.Aggregate(results))
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error: writing aggregate CSV:", err)
+			os.Exit(1)
+		}
+	}
+	if output.jsonPath != "" {
+		err := writeOutput(output.jsonPath, func(w io.Writer) error {
+			return dassim.WriteJSON(w, config, results)
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error: writing JSON:", err)
+			os.Exit(1)
 		}
 	}
 }
 
-// SimulationConfig holds the configuration for running simulations
-type SimulationConfig struct {
-	// SamplesPerIteration is the number of unique samples to generate in each iteration
-	// This represents how many points we try to recover in each step
-	SamplesPerIteration int
-
-	// Iterations is the number of times to run each simulation scenario
-	// Higher values provide more accurate probability estimates but take longer to run
-	Iterations int
-
-	// InitialLights is the starting number of light sources for the simulation
-	// This value may be overridden by LightsAt16 calculation
-	InitialLights int
-
-	// LightsAt16 is used to calculate InitialLights for different grid sizes
-	// If non-zero, InitialLights is scaled proportionally to the grid size
-	// Formula: InitialLights = LightsAt16 * (currentSize^2) / (16^2)
-	LightsAt16 int
-
-	// SizeIterFactor determines how much to increment the number of lights
-	// in each iteration. The increment is calculated as: size / SizeIterFactor
-	SizeIterFactor int
-
-	// InitialSize is the starting size for the data square
-	// The actual grid will be 2x this size in both dimensions
-	InitialSize int
-
-	// MaxSize is the largest size to test
-	// The simulation will double the size until reaching this value
-	MaxSize int
-
-	// TargetProbability is the success rate we want to achieve
-	// Once this probability is reached, we move to the next size
-	// Value should be between 0 and 1 (e.g., 0.99 for 99%)
-	TargetProbability float64
-}
+// checkpointConfig reads the config stored in the checkpoint at path, which
+// the JSON output reports for a resumed simulation
+func checkpointConfig(path string) (*dassim.SimulationConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
 
-// NewDefaultConfig creates a SimulationConfig with default values
-func NewDefaultConfig() *SimulationConfig {
-	return &SimulationConfig{
-		SamplesPerIteration: 16,
-		Iterations:          1000,
-		LightsAt16:          10,
-		InitialLights:       7500,
-		SizeIterFactor:      16,
-		InitialSize:         16,
-		MaxSize:             256,
-		TargetProbability:   0.99,
+	var checkpoint struct {
+		Config *dassim.SimulationConfig `json:"config"`
 	}
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("parsing checkpoint %s: %w", path, err)
+	}
+	if checkpoint.Config == nil {
+		return nil, fmt.Errorf("parsing checkpoint %s: missing config", path)
+	}
+	return checkpoint.Config, nil
 }
 
-// RunSimulation executes the main simulation with the given configuration
-func RunSimulation(config *SimulationConfig) {
-	log.Printf("Starting simulation with target probability: %.2f%%\n", config.TargetProbability*100)
-
-	for size := config.InitialSize; size <= config.MaxSize; size *= 2 {
-		log.Printf("\nProcessing size: %d x %d\n", size*2, size*2)
-
-		ds := NewDataSquare(size)
-		samples := NewSampleSet(config.SamplesPerIteration)
-
-		initialLights := config.InitialLights
-		if config.LightsAt16 != 0 {
-			initialLights = config.LightsAt16 * (size * size) / (16 * 16)
-		}
-
-		log.Printf("Initial lights: %d\n", initialLights)
-
-		for lights := initialLights; ; lights += size / config.SizeIterFactor {
-			successCount := 0
-
-			for i := 0; i < config.Iterations; i++ {
-				ds.Reset()
-
-				for n := 0; n < lights; n++ {
-					samples.FillUnique(config.SamplesPerIteration, size)
-					ds.AddSamples(samples)
-					samples.Clear()
-				}
-
-				if ds.Recover() {
-					successCount++
-				}
-			}
-
-			probability := float64(successCount) / float64(config.Iterations)
-			log.Printf("Lights: %d, Success Rate: %.2f%% (%d/%d)\n",
-				lights,
-				probability*100,
-				successCount,
-				config.Iterations)
-
-			if probability >= config.TargetProbability {
-				log.Printf("Target probability reached for size %d with %d lights\n", size, lights)
-				break
-			}
-		}
+// writeOutput calls write with the file at path, or with stdout when path is -
+func writeOutput(path string, write func(w io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
 	}
-}
 
-func main() {
-	rand.Seed(1)
-	config := NewDefaultConfig()
-	RunSimulation(config)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
 }
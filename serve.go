@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/walldiss/Celestia-DAS-simulations/dassim"
+)
+
+// Limits on the simulations a client may request, so a single request
+// cannot exhaust the memory and CPU of the server
+const (
+	serveMaxSize          = 256
+	serveMaxLights        = 4 * serveMaxSize * serveMaxSize
+	serveMaxIterations    = 20000
+	serveMaxSamples       = 4096
+	serveMaxBodyBytes     = 1 << 20
+	serveMaxRepeats       = 10
+	serveMaxParallelSizes = 4
+	serveMaxModels        = 2
+)
+
+// serve runs an HTTP server on addr that launches simulations on request
+func serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /defaults", handleDefaults)
+	mux.HandleFunc("POST /simulate", handleSimulate)
+
+	log.Printf("Serving simulations on %s\n", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// handleDefaults responds with the default simulation config
+func handleDefaults(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, dassim.NewDefaultConfig())
+}
+
+// handleSimulate runs the simulation configured by the JSON request body,
+// whose missing fields keep their default values, and responds with the
+// results. Configs beyond the serve limits are rejected, and the run is
+// cancelled when the client disconnects.
+func handleSimulate(w http.ResponseWriter, r *http.Request) {
+	config := dassim.NewDefaultConfig()
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, serveMaxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(config); err != nil {
+		http.Error(w, "parsing config: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := config.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkServeLimits(config); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results, err := dassim.RunSimulationContext(r.Context(), config)
+	if r.Context().Err() != nil {
+		// the client is gone, so there is nobody to respond to
+		log.Printf("simulation cancelled: %v\n", r.Context().Err())
+		return
+	}
+	if err != nil && !errors.Is(err, dassim.ErrThresholdNotReached) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// sizes that did not reach the target are reported through Reached
+	writeJSONResponse(w, results)
+}
+
+// checkServeLimits rejects configs that would write files on the server or
+// exceed the serve limits
+func checkServeLimits(config *dassim.SimulationConfig) error {
+	largest := config.MaxSize
+	if len(config.Sizes) > 0 {
+		largest = slices.Max(config.Sizes)
+	}
+
+	switch {
+	case config.CheckpointPath != "":
+		return fmt.Errorf("checkpoint_path cannot be set by clients")
+	case largest > serveMaxSize:
+		return fmt.Errorf("sizes must not exceed %d, got %d", serveMaxSize, largest)
+	case config.MaxLights > serveMaxLights:
+		return fmt.Errorf("max_lights must not exceed %d, got %d", serveMaxLights, config.MaxLights)
+	case config.SamplesPerIteration > serveMaxSamples:
+		return fmt.Errorf("samples_per_iteration must not exceed %d, got %d", serveMaxSamples, config.SamplesPerIteration)
+	case config.SweepVariable == dassim.SweepSamplesPerNode && 4*largest*largest > serveMaxSamples:
+		// the sweep may climb to every cell of the extended square
+		return fmt.Errorf("sweeping samples per node is limited to sizes with at most %d cells, got size %d", serveMaxSamples, largest)
+	case config.Iterations > serveMaxIterations:
+		return fmt.Errorf("iterations must not exceed %d, got %d", serveMaxIterations, config.Iterations)
+	case config.AdaptiveIterations && config.MaxIterations > serveMaxIterations:
+		return fmt.Errorf("max_iterations must not exceed %d, got %d", serveMaxIterations, config.MaxIterations)
+	case config.Repeats > serveMaxRepeats:
+		return fmt.Errorf("repeats must not exceed %d, got %d", serveMaxRepeats, config.Repeats)
+	case config.ParallelSizes > serveMaxParallelSizes:
+		return fmt.Errorf("parallel_sizes must not exceed %d, got %d", serveMaxParallelSizes, config.ParallelSizes)
+	case len(config.CompareModels) > serveMaxModels:
+		return fmt.Errorf("compare_models must not list more than %d models, got %d", serveMaxModels, len(config.CompareModels))
+	case config.InitialLightsFor(largest) > serveMaxLights:
+		// the starting lights grow with size and stay fixed with SweepSamplesPerNode
+		return fmt.Errorf("initial lights must not exceed %d, got %d at size %d", serveMaxLights, config.InitialLightsFor(largest), largest)
+	}
+	return nil
+}
+
+// writeJSONResponse writes v as the JSON body of the response
+func writeJSONResponse(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("writing response: %v\n", err)
+	}
+}